@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"polaredge-agent/internal/config"
+)
+
+// controlClient talks to a running agent over its control socket.
+type controlClient struct {
+	http *http.Client
+}
+
+// newControlClient parses the -config flag shared by the operator commands
+// and returns a client for the configured control socket, along with the
+// remaining arguments.
+func newControlClient(fs *flag.FlagSet, args []string) (*controlClient, []string, error) {
+	configFile := fs.String("config", config.DefaultPath, "path to the agent config file")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	socket := cfg.ControlSocket
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+	return &controlClient{http: &http.Client{
+		Timeout:   time.Minute,
+		Transport: &http.Transport{DialContext: dial},
+	}}, fs.Args(), nil
+}
+
+// do sends a request to the agent, with in as JSON body unless it is nil,
+// and decodes a JSON response into out, unless out is nil.
+func (c *controlClient) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://agent"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("agent not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"polaredge-agent/internal/policy"
+)
+
+const exposureUsage = `usage: polaredge-agent exposure [-config file] <command>
+
+  list                                   stored decisions
+  set <host:port> <public|private|off>   decide how a route is exposed
+      [-port N] [-for 24h] [-by name] [-note text]
+  revoke <host:port>                     hand the route back to the policy
+`
+
+// runExposure implements `polaredge-agent exposure`, managing the operator
+// decisions of the running agent over its control socket.
+func runExposure(args []string) int {
+	fs := flag.NewFlagSet("exposure", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, exposureUsage) }
+	ctl, rest, err := newControlClient(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if len(rest) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	switch cmd := rest[0]; {
+	case cmd == "list" && len(rest) == 1:
+		err = exposureList(ctl)
+	case cmd == "set" && len(rest) >= 3:
+		err = exposureSet(ctl, rest[1], rest[2], rest[3:])
+	case cmd == "revoke" && len(rest) == 2:
+		err = exposureRevoke(ctl, rest[1])
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func exposureList(ctl *controlClient) error {
+	var records []policy.Record
+	if err := ctl.do(http.MethodGet, "/v1/exposure", nil, &records); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTE\tMODE\tEXPOSED ON\tBY\tAT\tEXPIRES\tNOTE")
+	for _, r := range records {
+		on, expires := "-", "never"
+		if r.ExposePort != 0 {
+			on = strconv.Itoa(r.ExposePort)
+		}
+		if r.ExpiresAt != nil {
+			expires = r.ExpiresAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Key(), r.Mode, on, r.DecidedBy, r.DecidedAt.Local().Format(time.DateTime), expires, r.Note)
+	}
+	return tw.Flush()
+}
+
+func exposureSet(ctl *controlClient, route, mode string, args []string) error {
+	fs := flag.NewFlagSet("exposure set", flag.ContinueOnError)
+	port := fs.Int("port", 0, "serve the route on this host port instead of :80")
+	ttl := fs.Duration("for", 0, "let the decision expire after this long (0 = never)")
+	by := fs.String("by", operatorName(), "who made the decision")
+	note := fs.String("note", "", "free-form note, e.g. a ticket")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	host, p, err := splitRoute(route)
+	if err != nil {
+		return err
+	}
+	rec := policy.Record{
+		Host:       host,
+		Port:       p,
+		Mode:       policy.Mode(mode),
+		ExposePort: *port,
+		DecidedBy:  *by,
+		Note:       *note,
+	}
+	if *ttl > 0 {
+		expires := time.Now().Add(*ttl)
+		rec.ExpiresAt = &expires
+	}
+	if err := ctl.do(http.MethodPost, "/v1/exposure", rec, nil); err != nil {
+		return err
+	}
+	fmt.Printf("✅ %s is now %s.\n", rec.Key(), rec.Mode)
+	return nil
+}
+
+func exposureRevoke(ctl *controlClient, route string) error {
+	host, port, err := splitRoute(route)
+	if err != nil {
+		return err
+	}
+	q := url.Values{"host": {host}, "port": {strconv.Itoa(port)}}
+	if err := ctl.do(http.MethodDelete, "/v1/exposure?"+q.Encode(), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Decision for %s revoked, the exposure policy applies again.\n", route)
+	return nil
+}
+
+// splitRoute parses "host:port".
+func splitRoute(route string) (string, int, error) {
+	i := strings.LastIndex(route, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("route %q must be host:port", route)
+	}
+	port, err := strconv.Atoi(route[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("route %q must be host:port", route)
+	}
+	return route[:i], port, nil
+}
+
+// operatorName is who runs the command, seen through sudo.
+func operatorName() string {
+	for _, env := range []string{"SUDO_USER", "USER"} {
+		if name := os.Getenv(env); name != "" {
+			return name
+		}
+	}
+	return "operator"
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"polaredge-agent/internal/history"
+)
+
+const historyUsage = `usage: polaredge-agent history [-config file] <command>
+
+  list                 applied config revisions, newest first
+  show <revision>      a revision's config and source manifests
+  rollback <revision>  switch back to a revision and pin it
+  unpin                lift the pin, render the current manifests again
+`
+
+// runHistory implements `polaredge-agent history`, talking to the running
+// agent over its control socket.
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, historyUsage) }
+	ctl, rest, err := newControlClient(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if len(rest) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	switch cmd := rest[0]; {
+	case cmd == "list" && len(rest) == 1:
+		err = historyList(ctl)
+	case cmd == "show" && len(rest) == 2:
+		err = historyShow(ctl, rest[1])
+	case cmd == "rollback" && len(rest) == 2:
+		err = historyRollback(ctl, rest[1])
+	case cmd == "unpin" && len(rest) == 1:
+		err = ctl.do(http.MethodPost, "/v1/history/unpin", nil, nil)
+		if err == nil {
+			fmt.Println("📌 Pin lifted, the agent renders its current manifests again.")
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func historyList(ctl *controlClient) error {
+	var entries []history.Entry
+	if err := ctl.do(http.MethodGet, "/v1/history", nil, &entries); err != nil {
+		return err
+	}
+	var state struct {
+		PinnedRevision int64 `json:"pinnedRevision"`
+	}
+	if err := ctl.do(http.MethodGet, "/v1/state", nil, &state); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REV\tTIME\tSOURCE\tSUMMARY")
+	for _, e := range entries {
+		rev := strconv.FormatInt(e.Revision, 10)
+		if e.Revision == state.PinnedRevision {
+			rev += " 📌"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rev, e.Timestamp.Local().Format(time.DateTime), e.Client, e.Summary)
+	}
+	return tw.Flush()
+}
+
+func historyShow(ctl *controlClient, revision string) error {
+	var rev history.Revision
+	if err := ctl.do(http.MethodGet, "/v1/history/"+revision, nil, &rev); err != nil {
+		return err
+	}
+
+	fmt.Printf("Revision:  %d\n", rev.Revision)
+	fmt.Printf("Time:      %s\n", rev.Timestamp.Local().Format(time.RFC3339))
+	fmt.Printf("Source:    %s\n", rev.Client)
+	fmt.Printf("Summary:   %s\n", rev.Summary)
+	clients := make([]string, 0, len(rev.Generations))
+	for client := range rev.Generations {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	for _, client := range clients {
+		fmt.Printf("Manifest:  %s generation %d\n", client, rev.Generations[client])
+	}
+
+	routes := make([]string, 0, len(rev.Routes))
+	for route, backend := range rev.Routes {
+		routes = append(routes, fmt.Sprintf("  %s → %s", route, backend))
+	}
+	sort.Strings(routes)
+	fmt.Printf("\nRoutes:\n%s\n", strings.Join(routes, "\n"))
+	fmt.Printf("\n# static\n%s\n# dynamic\n%s", rev.StaticConfig, rev.DynamicConfig)
+	return nil
+}
+
+func historyRollback(ctl *controlClient, revision string) error {
+	var entry history.Entry
+	if err := ctl.do(http.MethodPost, "/v1/history/"+revision+"/rollback", nil, &entry); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Rolled back to revision %s (recorded as revision %d), pinned until the next manifest or `history unpin`.\n", revision, entry.Revision)
+	return nil
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ControlHandler returns the API routes plus the operator-only ones, which are
+// served on the control socket and never on the network:
+//
+//	POST /v1/history/{revision}/rollback  switch back to a revision and pin it
+//	POST /v1/history/unpin                lift a rollback pin
+//	POST /v1/exposure                     store an exposure decision
+//	DELETE /v1/exposure?host=&port=       revoke an exposure decision
+//	POST /v1/pending/{host:port}/approve  expose a pending route
+//	POST /v1/pending/{host:port}/deny     keep a pending route off
+func (s *Server) ControlHandler() http.Handler {
+	api := s.Handler()
+	mux := http.NewServeMux()
+	mux.Handle("/", api)
+	// Exact paths, so the subtree patterns below do not redirect them.
+	mux.Handle("/v1/history", api)
+	mux.Handle("/v1/pending", api)
+	mux.HandleFunc("/v1/history/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/history/unpin":
+			s.handleUnpin(w, r)
+		case strings.HasSuffix(r.URL.Path, "/rollback"):
+			s.handleRollback(w, r)
+		default:
+			api.ServeHTTP(w, r)
+		}
+	})
+	mux.HandleFunc("/v1/exposure", s.handleExposureControl)
+	mux.HandleFunc("/v1/pending/", s.handleResolve)
+	return mux
+}
+
+// ServeControl serves ControlHandler on a unix socket at path. The socket is
+// only accessible to the agent's user; file permissions are the only access
+// check.
+func (s *Server) ServeControl(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create control socket dir: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove stale control socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+
+	log.Printf("🎛️  Control socket listening on %s", path)
+	return s.httpServer(s.ControlHandler()).Serve(ln)
+}
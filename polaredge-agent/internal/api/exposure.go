@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"polaredge-agent/internal/policy"
+)
+
+// handleExposure serves GET /v1/exposure, the stored exposure decisions.
+func (s *Server) handleExposure(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Manager.Decisions())
+}
+
+// handleExposureControl adds the operator actions on the control socket:
+//
+//	POST   /v1/exposure                 store a decision (policy.Record)
+//	DELETE /v1/exposure?host=&port=     revoke a decision
+func (s *Server) handleExposureControl(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleExposure(w, r)
+	case http.MethodPost:
+		var rec policy.Record
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err == nil {
+			err = json.Unmarshal(body, &rec)
+		}
+		if err != nil {
+			http.Error(w, "invalid decision: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rec.Host == "" {
+			http.Error(w, "host is required", http.StatusUnprocessableEntity)
+			return
+		}
+		if err := s.Manager.SetDecision(rec); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		host := r.URL.Query().Get("host")
+		port, err := strconv.Atoi(r.URL.Query().Get("port"))
+		if host == "" || err != nil {
+			http.Error(w, "host and port are required", http.StatusBadRequest)
+			return
+		}
+		ok, err := s.Manager.RevokeDecision(host, port)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "no decision for "+host+":"+strconv.Itoa(port), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"polaredge-agent/internal/history"
+)
+
+// handleHistory serves GET /v1/history and GET /v1/history/{revision}.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/history"), "/")
+	if rest == "" {
+		entries, err := s.Manager.History().List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+
+	revision, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid revision "+strconv.Quote(rest), http.StatusBadRequest)
+		return
+	}
+	rev, err := s.Manager.History().Get(revision)
+	if err != nil {
+		http.Error(w, err.Error(), historyStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, rev)
+}
+
+// handleRollback serves POST /v1/history/{revision}/rollback.
+func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	rest := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/history/"), "/rollback")
+	revision, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid revision "+strconv.Quote(rest), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := s.Manager.Rollback(revision)
+	if err != nil {
+		http.Error(w, err.Error(), historyStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// handleUnpin serves POST /v1/history/unpin.
+func (s *Server) handleUnpin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if err := s.Manager.Unpin(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func historyStatus(err error) int {
+	if errors.Is(err, history.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusUnprocessableEntity
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"polaredge-agent/internal/manager"
+	"polaredge-agent/internal/policy"
+)
+
+// handlePending serves GET /v1/pending, the routes waiting for approval.
+func (s *Server) handlePending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Manager.Pending())
+}
+
+// handleResolve serves POST /v1/pending/{host:port}/approve and .../deny on
+// the control socket. The body is an optional policy.Record carrying mode
+// (public or private, for approve), port, decidedBy and note.
+func (s *Server) handleResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/pending/")
+	key, action, _ := strings.Cut(rest, "/")
+
+	var rec policy.Record
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err == nil && len(body) > 0 {
+		err = json.Unmarshal(body, &rec)
+	}
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "approve":
+		if rec.Mode == "" {
+			rec.Mode = policy.Public
+		}
+		if rec.Mode != policy.Public && rec.Mode != policy.Private {
+			http.Error(w, "approve needs mode public or private", http.StatusUnprocessableEntity)
+			return
+		}
+	case "deny":
+		rec.Mode, rec.ExposePort = policy.Off, 0
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := s.Manager.Resolve(key, rec); err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, manager.ErrNotPending) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"polaredge-agent/internal/auth"
+	"polaredge-agent/internal/manager"
+	"polaredge-agent/internal/protocol"
+	"polaredge-agent/internal/tlsutil"
+)
+
+// maxBodySize caps request bodies, matching the socket's envelope limit.
+const maxBodySize = 8 << 20
+
+// Headers carrying the detached signature of a POST /v1/intents body.
+const (
+	HeaderKeyID     = "X-Polaredge-Key-Id"
+	HeaderTimestamp = "X-Polaredge-Timestamp"
+	HeaderSignature = "X-Polaredge-Signature"
+)
+
+// Server exposes the agent over HTTP:
+//
+//	POST /v1/manifests          signed manifest envelope (Content-Encoding: gzip allowed)
+//	GET  /v1/manifests          latest manifest per client
+//	GET  /v1/manifests?client=  latest and applied manifest of one client
+//	GET  /v1/manifests/{client} same, for identities without slashes
+//	POST /v1/intents            single-route intent (detached signature headers)
+//	GET  /v1/intents            stored intents
+//	GET  /v1/state              sources, intents and last apply result
+//	GET  /v1/config             rendered Traefik config
+//	GET  /v1/history            applied config revisions, newest first
+//	GET  /v1/history/{revision} one revision with its config and manifests
+//	GET  /v1/exposure           operator exposure decisions
+//	GET  /v1/pending            routes waiting for an operator's approval
+//	GET  /v1/ca                 internal CA certificate (PEM) for private routes
+//
+// Operator actions are only served on the control socket, see ControlHandler.
+type Server struct {
+	Addr       string
+	Manager    *manager.Manager
+	Keyring    *auth.Keyring
+	Authorizer *auth.Authorizer
+	TLS        *tls.Config
+	// MaxManifestSize limits a manifest body after Content-Encoding is undone.
+	MaxManifestSize int64
+	// AckTimeout is how long a manifest POST may wait for its ack; the write
+	// timeout leaves room for it.
+	AckTimeout time.Duration
+}
+
+// Timeouts of the API and control servers. The write timeout runs while the
+// handler does, so it also covers waiting for an apply or a rollback.
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = time.Minute
+)
+
+// httpServer serves handler with the timeouts above, so a slow or idle peer
+// cannot hold a connection open.
+func (s *Server) httpServer(handler http.Handler) *http.Server {
+	write := writeTimeout
+	if need := s.AckTimeout + 10*time.Second; write < need {
+		write = need
+	}
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      write,
+		IdleTimeout:       2 * time.Minute,
+	}
+}
+
+// Handler returns the API routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/manifests", s.handleManifests)
+	mux.HandleFunc("/v1/manifests/", s.handleManifest)
+	mux.HandleFunc("/v1/intents", s.handleIntents)
+	mux.HandleFunc("/v1/state", s.handleState)
+	mux.HandleFunc("/v1/config", s.handleConfig)
+	mux.HandleFunc("/v1/history", s.handleHistory)
+	mux.HandleFunc("/v1/history/", s.handleHistory)
+	mux.HandleFunc("/v1/exposure", s.handleExposure)
+	mux.HandleFunc("/v1/pending", s.handlePending)
+	mux.HandleFunc("/v1/ca", s.handleCA)
+	return mux
+}
+
+// ListenAndServe serves the API until the listener fails.
+func (s *Server) ListenAndServe() error {
+	srv := s.httpServer(s.Handler())
+	srv.Addr, srv.TLSConfig = s.Addr, s.TLS
+	if s.TLS != nil {
+		log.Printf("🌐 HTTP API listening on https://%s", s.Addr)
+		return srv.ListenAndServeTLS("", "")
+	}
+	log.Printf("🌐 HTTP API listening on http://%s", s.Addr)
+	return srv.ListenAndServe()
+}
+
+func (s *Server) handleManifests(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if client := r.URL.Query().Get("client"); client != "" {
+			s.writeSource(w, client)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Manager.State().Sources)
+	case http.MethodPost:
+		s.postManifest(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) postManifest(w http.ResponseWriter, r *http.Request) {
+	encoding, err := protocol.EncodingByName(r.Header.Get("Content-Encoding"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "request body too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+	raw, err := protocol.Decompress(encoding, body, s.MaxManifestSize)
+	if errors.Is(err, protocol.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	env, err := protocol.Decode(raw)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonMalformed, Error: err.Error()})
+		return
+	}
+
+	peer, err := peerIdentity(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonUnauthorized, Generation: env.Generation, Error: err.Error()})
+		return
+	}
+	if err := s.Authorizer.Authorize(peer, env); err != nil {
+		log.Printf("🔒 Unauthorized manifest from %s: %v", r.RemoteAddr, err)
+		writeJSON(w, http.StatusForbidden, protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonUnauthorized, Generation: env.Generation, Error: err.Error()})
+		return
+	}
+	if err := s.Keyring.Verify(env); err != nil {
+		log.Printf("🔒 Rejected manifest from %s (client %q): %v", r.RemoteAddr, env.Client, err)
+		writeJSON(w, statusFor(err), protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonUnauthorized, Generation: env.Generation, Error: err.Error()})
+		return
+	}
+	if err := s.Keyring.Commit(env); err != nil {
+		log.Printf("🔒 Rejected manifest from %s (client %q): %v", r.RemoteAddr, env.Client, err)
+		writeJSON(w, statusFor(err), protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonUnauthorized, Generation: env.Generation, Error: err.Error()})
+		return
+	}
+
+	ack := s.Manager.Submit(env)
+	switch ack.Status {
+	case protocol.AckApplied:
+		writeJSON(w, http.StatusOK, ack)
+	case protocol.AckQueued:
+		writeJSON(w, http.StatusAccepted, ack)
+	default:
+		writeJSON(w, http.StatusUnprocessableEntity, ack)
+	}
+}
+
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	s.writeSource(w, strings.TrimPrefix(r.URL.Path, "/v1/manifests/"))
+}
+
+func (s *Server) writeSource(w http.ResponseWriter, client string) {
+	src, ok := s.Manager.Source(client)
+	if !ok {
+		http.Error(w, "no manifest from client "+strconv.Quote(client), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, src)
+}
+
+func (s *Server) handleIntents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.Manager.State().Intents)
+	case http.MethodPost:
+		s.postIntent(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// postIntent authenticates the detached signature headers before handing the
+// body to the manager:
+//
+//	X-Polaredge-Key-Id:    signing key id
+//	X-Polaredge-Timestamp: unix seconds
+//	X-Polaredge-Signature: base64 signature over "<timestamp>\n<body>"
+func (s *Server) postIntent(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "request body too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	keyID := r.Header.Get(HeaderKeyID)
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil && keyID != "" {
+		http.Error(w, "invalid "+HeaderTimestamp, http.StatusBadRequest)
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get(HeaderSignature))
+	if err != nil {
+		http.Error(w, "invalid "+HeaderSignature, http.StatusBadRequest)
+		return
+	}
+	if err := s.Keyring.VerifyRequest(keyID, ts, body, sig); err != nil {
+		log.Printf("🔒 Rejected intent from %s: %v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	peer, err := peerIdentity(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	// An intent names no client, so the allowlist can only be checked
+	// against a certificate identity.
+	if peer == "" && s.Authorizer.Restricted() {
+		log.Printf("🔒 Rejected intent from %s: no client certificate", r.RemoteAddr)
+		http.Error(w, "intents need a client certificate when clients are configured", http.StatusForbidden)
+		return
+	}
+	if err := s.Authorizer.AuthorizeKey(peer, keyID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	s.Manager.HandleIngressIntent(w, r)
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Manager.State())
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	cfg := s.Manager.RenderedConfig()
+	if cfg == "" {
+		http.Error(w, "no config rendered yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, cfg)
+}
+
+func (s *Server) handleCA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	bundle := s.Manager.CABundle()
+	if bundle == nil {
+		http.Error(w, "no internal CA configured", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	_, _ = w.Write(bundle)
+}
+
+func peerIdentity(r *http.Request) (string, error) {
+	if r.TLS == nil {
+		return "", nil
+	}
+	return tlsutil.PeerIdentity(*r.TLS)
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrStale):
+		return http.StatusConflict
+	case errors.Is(err, auth.ErrUnauthorized):
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
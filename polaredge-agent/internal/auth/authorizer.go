@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"polaredge-agent/internal/config"
+	"polaredge-agent/internal/protocol"
+)
+
+// ErrUnauthorized is returned when an authenticated client may not push.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authorizer decides whether a client identity may push manifests.
+type Authorizer struct {
+	clients map[string]config.ClientConfig
+}
+
+// NewAuthorizer indexes the configured clients by identity. With no clients
+// configured every client holding a valid signing key is allowed.
+func NewAuthorizer(clients []config.ClientConfig) *Authorizer {
+	a := &Authorizer{clients: make(map[string]config.ClientConfig)}
+	for _, c := range clients {
+		a.clients[c.Identity] = c
+	}
+	return a
+}
+
+// Authorize checks env against the identity of the connection. peer is the
+// identity taken from the client certificate, or empty on plain TCP, in which
+// case the identity asserted in the envelope is used.
+func (a *Authorizer) Authorize(peer string, env *protocol.Envelope) error {
+	identity := env.Client
+	if peer != "" {
+		if env.Client != peer {
+			return fmt.Errorf("%w: envelope client %q does not match certificate identity %q", ErrUnauthorized, env.Client, peer)
+		}
+		identity = peer
+	}
+
+	keyID := ""
+	if env.Signature != nil {
+		keyID = env.Signature.KeyID
+	}
+	return a.AuthorizeKey(identity, keyID)
+}
+
+// Restricted reports whether only configured clients may push.
+func (a *Authorizer) Restricted() bool {
+	return len(a.clients) > 0
+}
+
+// AuthorizeKey checks that identity is a known client allowed to sign with keyID.
+func (a *Authorizer) AuthorizeKey(identity, keyID string) error {
+	if len(a.clients) == 0 {
+		return nil
+	}
+	c, ok := a.clients[identity]
+	if !ok {
+		return fmt.Errorf("%w: client %q is not authorized", ErrUnauthorized, identity)
+	}
+	if len(c.Keys) == 0 {
+		return nil
+	}
+	for _, id := range c.Keys {
+		if keyID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: client %q may not sign with key %q", ErrUnauthorized, identity, keyID)
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"polaredge-agent/internal/config"
+	"polaredge-agent/internal/protocol"
+)
+
+// Verification errors, so callers can map them to protocol responses.
+var (
+	ErrUnsigned     = errors.New("manifest is not signed")
+	ErrBadSignature = errors.New("signature rejected")
+	ErrStale        = errors.New("stale manifest")
+)
+
+type key struct {
+	id        string
+	alg       string
+	secret    []byte
+	publicKey ed25519.PublicKey
+	notAfter  *time.Time
+}
+
+// Keyring verifies envelopes against every currently active signing key and
+// rejects replayed or stale envelopes per client.
+type Keyring struct {
+	keys    map[string]key
+	maxSkew time.Duration
+
+	mu       sync.Mutex
+	lastSeen map[string]int64 // client → highest accepted generation
+}
+
+// NewKeyring builds a keyring from the agent config.
+func NewKeyring(keys []config.KeyConfig, maxSkew time.Duration) (*Keyring, error) {
+	kr := &Keyring{
+		keys:     make(map[string]key),
+		maxSkew:  maxSkew,
+		lastSeen: make(map[string]int64),
+	}
+
+	for _, kc := range keys {
+		if kc.ID == "" {
+			return nil, errors.New("signing key without id")
+		}
+		if _, dup := kr.keys[kc.ID]; dup {
+			return nil, fmt.Errorf("duplicate signing key id %q", kc.ID)
+		}
+
+		k := key{id: kc.ID, alg: kc.Algorithm, notAfter: kc.NotAfter}
+		switch kc.Algorithm {
+		case protocol.AlgHMACSHA256:
+			secret, err := base64.StdEncoding.DecodeString(kc.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: decode secret: %w", kc.ID, err)
+			}
+			if len(secret) < 32 {
+				return nil, fmt.Errorf("key %s: hmac secret must be at least 32 bytes", kc.ID)
+			}
+			k.secret = secret
+		case protocol.AlgEd25519:
+			pub, err := base64.StdEncoding.DecodeString(kc.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: decode public key: %w", kc.ID, err)
+			}
+			if len(pub) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("key %s: ed25519 public key must be %d bytes", kc.ID, ed25519.PublicKeySize)
+			}
+			k.publicKey = pub
+		default:
+			return nil, fmt.Errorf("key %s: unsupported algorithm %q", kc.ID, kc.Algorithm)
+		}
+		kr.keys[kc.ID] = k
+	}
+
+	if len(kr.keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+	return kr, nil
+}
+
+// Verify checks the envelope signature, its freshness and its generation. It
+// records nothing: once the envelope is also authorized, Commit records its
+// generation, so an envelope refused later cannot advance the client's
+// replay counter.
+func (kr *Keyring) Verify(env *protocol.Envelope) error {
+	if env.Signature == nil || len(env.Signature.Value) == 0 {
+		return ErrUnsigned
+	}
+
+	if err := kr.check(env.Signature.KeyID, env.Signature.Algorithm, env.SigningBytes(), env.Signature.Value); err != nil {
+		return err
+	}
+
+	if skew := time.Since(env.Timestamp); skew > kr.maxSkew || skew < -kr.maxSkew {
+		return fmt.Errorf("%w: envelope timestamp %s outside allowed clock skew", ErrStale, env.Timestamp.Format(time.RFC3339))
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.checkGenerationLocked(env)
+}
+
+// Commit records the generation of a verified and authorized envelope. It
+// checks the generation again, as another envelope from the client may have
+// been committed since Verify.
+func (kr *Keyring) Commit(env *protocol.Envelope) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if err := kr.checkGenerationLocked(env); err != nil {
+		return err
+	}
+	kr.lastSeen[env.Client] = env.Generation
+	return nil
+}
+
+func (kr *Keyring) checkGenerationLocked(env *protocol.Envelope) error {
+	if last, ok := kr.lastSeen[env.Client]; ok && env.Generation < last {
+		return fmt.Errorf("%w: generation %d for client %q (last %d)", ErrStale, env.Generation, env.Client, last)
+	}
+	return nil
+}
+
+// VerifyRequest checks a detached signature over a raw request body, as sent
+// by HTTP clients that post single intents. The signed bytes are the unix
+// timestamp, a newline and the body, so old requests cannot be replayed.
+func (kr *Keyring) VerifyRequest(keyID string, timestamp int64, body, sig []byte) error {
+	if keyID == "" || len(sig) == 0 {
+		return ErrUnsigned
+	}
+	k, ok := kr.keys[keyID]
+	if !ok {
+		return fmt.Errorf("%w: unknown signing key %q", ErrBadSignature, keyID)
+	}
+
+	msg := append([]byte(strconv.FormatInt(timestamp, 10)+"\n"), body...)
+	if err := kr.check(keyID, k.alg, msg, sig); err != nil {
+		return err
+	}
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > kr.maxSkew || skew < -kr.maxSkew {
+		return fmt.Errorf("%w: request timestamp outside allowed clock skew", ErrStale)
+	}
+	return nil
+}
+
+func (kr *Keyring) check(keyID, alg string, msg, sig []byte) error {
+	k, ok := kr.keys[keyID]
+	if !ok {
+		return fmt.Errorf("%w: unknown signing key %q", ErrBadSignature, keyID)
+	}
+	if k.alg != alg {
+		return fmt.Errorf("%w: key %s does not use %s", ErrBadSignature, k.id, alg)
+	}
+	if k.notAfter != nil && time.Now().After(*k.notAfter) {
+		return fmt.Errorf("%w: signing key %s retired at %s", ErrBadSignature, k.id, k.notAfter.Format(time.RFC3339))
+	}
+
+	switch k.alg {
+	case protocol.AlgHMACSHA256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(msg)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("%w: bad signature", ErrBadSignature)
+		}
+	case protocol.AlgEd25519:
+		if !ed25519.Verify(k.publicKey, msg, sig) {
+			return fmt.Errorf("%w: bad signature", ErrBadSignature)
+		}
+	}
+	return nil
+}
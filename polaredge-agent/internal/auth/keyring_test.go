@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"polaredge-agent/internal/config"
+	"polaredge-agent/internal/protocol"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func hmacKey(id string) config.KeyConfig {
+	return config.KeyConfig{ID: id, Algorithm: protocol.AlgHMACSHA256, Secret: base64.StdEncoding.EncodeToString(testSecret)}
+}
+
+func signed(keyID, client string, generation int64) *protocol.Envelope {
+	env := &protocol.Envelope{
+		Version:    protocol.Version,
+		Client:     client,
+		Generation: generation,
+		Timestamp:  time.Now(),
+		Manifest:   json.RawMessage(`[]`),
+	}
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write(env.SigningBytes())
+	env.Signature = &protocol.Signature{Algorithm: protocol.AlgHMACSHA256, KeyID: keyID, Value: mac.Sum(nil)}
+	return env
+}
+
+func TestUnauthorizedEnvelopeKeepsReplayCounter(t *testing.T) {
+	kr, err := NewKeyring([]config.KeyConfig{hmacKey("k1")}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz := NewAuthorizer([]config.ClientConfig{{Identity: "c1"}, {Identity: "c2"}})
+
+	// c2 holds a valid key but claims to be c1, with a high generation.
+	forged := signed("k1", "c1", 100)
+	if err := authz.Authorize("c2", forged); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Authorize = %v, want ErrUnauthorized", err)
+	}
+	if err := kr.Verify(forged); err != nil {
+		t.Fatalf("Verify = %v", err)
+	}
+
+	// Neither the refused envelope nor Verify alone moved c1's counter.
+	env := signed("k1", "c1", 5)
+	if err := authz.Authorize("c1", env); err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Verify(env); err != nil {
+		t.Fatalf("Verify of c1's own generation = %v", err)
+	}
+	if err := kr.Commit(env); err != nil {
+		t.Fatalf("Commit = %v", err)
+	}
+
+	if err := kr.Verify(signed("k1", "c1", 4)); !errors.Is(err, ErrStale) {
+		t.Fatalf("Verify of an older generation = %v, want ErrStale", err)
+	}
+	if err := kr.Commit(signed("k1", "c1", 5)); err != nil {
+		t.Fatalf("Commit of the same generation = %v, resends must pass", err)
+	}
+}
+
+func TestCommitRechecksGeneration(t *testing.T) {
+	kr, err := NewKeyring([]config.KeyConfig{hmacKey("k1")}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	older, newer := signed("k1", "c1", 1), signed("k1", "c1", 2)
+	for _, env := range []*protocol.Envelope{older, newer} {
+		if err := kr.Verify(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kr.Commit(newer); err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Commit(older); !errors.Is(err, ErrStale) {
+		t.Fatalf("Commit of a generation overtaken since Verify = %v, want ErrStale", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey := config.KeyConfig{ID: "k2", Algorithm: protocol.AlgEd25519, PublicKey: base64.StdEncoding.EncodeToString(pub)}
+	edSigned := func(client string, generation int64) *protocol.Envelope {
+		env := signed("k1", client, generation)
+		env.Signature = &protocol.Signature{Algorithm: protocol.AlgEd25519, KeyID: "k2", Value: ed25519.Sign(priv, env.SigningBytes())}
+		return env
+	}
+
+	// During a rotation the old key is retired in the future and both keys
+	// are accepted, so clients can move over one by one.
+	retiresAt := time.Now().Add(time.Hour)
+	old := hmacKey("k1")
+	old.NotAfter = &retiresAt
+	kr, err := NewKeyring([]config.KeyConfig{old, edKey}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Verify(signed("k1", "c1", 1)); err != nil {
+		t.Errorf("old key before NotAfter: %v", err)
+	}
+	if err := kr.Verify(edSigned("c2", 1)); err != nil {
+		t.Errorf("new key: %v", err)
+	}
+
+	// Once NotAfter has passed the old key is refused; the new one keeps
+	// working.
+	retiredAt := time.Now().Add(-time.Minute)
+	old.NotAfter = &retiredAt
+	if kr, err = NewKeyring([]config.KeyConfig{old, edKey}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Verify(signed("k1", "c1", 2)); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("retired key = %v, want ErrBadSignature", err)
+	}
+	if err := kr.Verify(edSigned("c2", 2)); err != nil {
+		t.Errorf("new key after the rotation: %v", err)
+	}
+
+	for name, env := range map[string]*protocol.Envelope{
+		"unknown key": signed("k3", "c1", 3),
+		"wrong algorithm": func() *protocol.Envelope {
+			env := edSigned("c2", 3)
+			env.Signature.Algorithm = protocol.AlgHMACSHA256
+			return env
+		}(),
+		"tampered": func() *protocol.Envelope {
+			env := edSigned("c2", 3)
+			env.Generation++
+			return env
+		}(),
+	} {
+		if err := kr.Verify(env); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s = %v, want ErrBadSignature", name, err)
+		}
+	}
+}
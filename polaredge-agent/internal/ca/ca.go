@@ -0,0 +1,316 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"polaredge-agent/internal/fsutil"
+)
+
+// caValidity is how long the root certificate is valid. It is not rotated.
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// Authority is the agent's local CA for private routes, which public ACME CAs
+// cannot reach. It issues a leaf certificate per host and replaces it once
+// two thirds of its validity have passed.
+type Authority struct {
+	dir          string
+	leafValidity time.Duration
+
+	mu      sync.Mutex
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	leaves  map[string]Leaf
+}
+
+// Leaf is an issued certificate and key, stored as PEM files.
+type Leaf struct {
+	Host      string
+	CertFile  string
+	KeyFile   string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// renewAt is when the leaf is replaced.
+func (l Leaf) renewAt() time.Time {
+	return l.NotAfter.Add(-l.NotAfter.Sub(l.NotBefore) / 3)
+}
+
+// Open loads the CA kept in dir, creating it on first use, and the leaves it
+// has issued.
+func Open(dir string, leafValidity time.Duration) (*Authority, error) {
+	a := &Authority{dir: dir, leafValidity: leafValidity, leaves: make(map[string]Leaf)}
+	if err := os.MkdirAll(a.leafDir(), 0700); err != nil {
+		return nil, err
+	}
+	if err := a.loadRoot(); err != nil {
+		return nil, err
+	}
+	if err := a.loadLeaves(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Bundle returns the CA certificate in PEM, for clients to trust.
+func (a *Authority) Bundle() []byte {
+	return append([]byte(nil), a.certPEM...)
+}
+
+// Leaf returns the current certificate of host, issuing a new one when there
+// is none or it is due for rotation.
+func (a *Authority) Leaf(host string) (Leaf, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if l, ok := a.leaves[host]; ok && time.Now().Before(l.renewAt()) {
+		return l, nil
+	}
+	l, err := a.issue(host)
+	if err != nil {
+		return Leaf{}, fmt.Errorf("issue certificate for %s: %w", host, err)
+	}
+	a.leaves[host] = l
+	a.pruneLocked(host)
+	log.Printf("🔏 Issued internal certificate for %s, valid until %s", host, l.NotAfter.Format(time.RFC3339))
+	return l, nil
+}
+
+// Retain stops rotating the leaves of hosts not in hosts. Their files stay
+// until they expire.
+func (a *Authority) Retain(hosts map[string]bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for host := range a.leaves {
+		if !hosts[host] {
+			delete(a.leaves, host)
+		}
+	}
+}
+
+// NextRotation is the earliest time a leaf is due for rotation, zero when
+// none has been issued.
+func (a *Authority) NextRotation() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var next time.Time
+	for _, l := range a.leaves {
+		if at := l.renewAt(); next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next
+}
+
+func (a *Authority) leafDir() string {
+	return filepath.Join(a.dir, "leaves")
+}
+
+func (a *Authority) loadRoot() error {
+	certPath := filepath.Join(a.dir, "ca.pem")
+	keyPath := filepath.Join(a.dir, "ca-key.pem")
+
+	certPEM, err := os.ReadFile(certPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return a.createRoot(certPath, keyPath)
+	}
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	cert, err := parseCert(certPEM)
+	if err != nil {
+		return fmt.Errorf("%s: %w", certPath, err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM key", keyPath)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", keyPath, err)
+	}
+	a.cert, a.key, a.certPEM = cert, key, certPEM
+	return nil
+}
+
+func (a *Authority) createRoot(certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "POLAREDGE internal CA " + host},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := fsutil.WriteFileAtomic(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(certPath, certPEM, 0644); err != nil {
+		return err
+	}
+	a.cert, a.key, a.certPEM = cert, key, certPEM
+	log.Printf("🔏 Created internal CA in %s", a.dir)
+	return nil
+}
+
+// loadLeaves restores the newest unexpired leaf of every host.
+func (a *Authority) loadLeaves() error {
+	entries, err := os.ReadDir(a.leafDir())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".crt") {
+			continue
+		}
+		certFile := filepath.Join(a.leafDir(), e.Name())
+		data, err := os.ReadFile(certFile)
+		if err != nil {
+			return err
+		}
+		cert, err := parseCert(data)
+		if err != nil || len(cert.DNSNames) == 0 || !now.Before(cert.NotAfter) {
+			continue
+		}
+		l := Leaf{
+			Host:      cert.DNSNames[0],
+			CertFile:  certFile,
+			KeyFile:   strings.TrimSuffix(certFile, ".crt") + ".key",
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		}
+		if have, ok := a.leaves[l.Host]; !ok || l.NotAfter.After(have.NotAfter) {
+			a.leaves[l.Host] = l
+		}
+	}
+	return nil
+}
+
+// issue writes a new leaf for host. The file names carry the expiry, so a
+// rotation changes the dynamic config and Traefik picks up the new files.
+func (a *Authority) issue(host string) (Leaf, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Leaf{}, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return Leaf{}, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(a.leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		return Leaf{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return Leaf{}, err
+	}
+
+	base := filepath.Join(a.leafDir(), fileSafe(host)+"-"+strconv.FormatInt(tmpl.NotAfter.Unix(), 10))
+	l := Leaf{Host: host, CertFile: base + ".crt", KeyFile: base + ".key", NotBefore: tmpl.NotBefore, NotAfter: tmpl.NotAfter}
+	// Traefik serves the chain, so clients only need the CA bundle.
+	chain := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), a.certPEM...)
+	if err := fsutil.WriteFileAtomic(l.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return Leaf{}, err
+	}
+	if err := fsutil.WriteFileAtomic(l.CertFile, chain, 0644); err != nil {
+		return Leaf{}, err
+	}
+	return l, nil
+}
+
+// pruneLocked removes the expired leaves of host. Replaced but unexpired ones
+// are kept, as an older config in history may still point at them.
+func (a *Authority) pruneLocked(host string) {
+	prefix := fileSafe(host) + "-"
+	entries, err := os.ReadDir(a.leafDir())
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".crt"), ".key")
+		expiry, err := strconv.ParseInt(stamp, 10, 64)
+		if err != nil || now.Before(time.Unix(expiry, 0)) {
+			continue
+		}
+		_ = os.Remove(filepath.Join(a.leafDir(), name))
+	}
+}
+
+func parseCert(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// fileSafe turns a hostname (possibly a wildcard) into a file name.
+func fileSafe(host string) string {
+	return strings.ReplaceAll(host, "*", "_wildcard")
+}
@@ -0,0 +1,128 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// verify checks that the leaf's files hold a key pair for host chaining to
+// the bundle, and returns the certificate.
+func verify(t *testing.T, a *Authority, l Leaf, host string) *x509.Certificate {
+	t.Helper()
+	pair, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(a.Bundle()) {
+		t.Fatal("bundle holds no certificate")
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+		t.Fatalf("leaf of %s does not verify: %v", host, err)
+	}
+	return cert
+}
+
+func TestLeafSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := a.Leaf("grafana.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify(t, a, l, "grafana.example.com")
+	if again, err := a.Leaf("grafana.example.com"); err != nil || again != l {
+		t.Fatalf("second Leaf = %+v, %v, want the same leaf", again, err)
+	}
+	if got, want := a.NextRotation(), l.renewAt(); !got.Equal(want) {
+		t.Errorf("NextRotation = %v, want %v", got, want)
+	}
+
+	// A restarted agent keeps its CA and serves the same leaf.
+	reopened, err := Open(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reopened.Bundle()) != string(a.Bundle()) {
+		t.Fatal("the CA changed on reopen")
+	}
+	got, err := reopened.Leaf("grafana.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CertFile != l.CertFile || got.NotAfter.Unix() != l.NotAfter.Unix() {
+		t.Fatalf("Leaf after reopen = %+v, want %+v", got, l)
+	}
+}
+
+func TestLeafRotation(t *testing.T) {
+	a, err := Open(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const host = "grafana.example.com"
+	old, err := a.Leaf(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCert := verify(t, a, old, host)
+
+	// Leaves from an earlier run: one expired, one replaced but still valid,
+	// which an older config in history may point at.
+	stale := make(map[string]bool)
+	for name, expiry := range map[string]time.Time{"expired": time.Now().Add(-time.Minute), "replaced": time.Now().Add(time.Minute)} {
+		base := filepath.Join(a.leafDir(), host+"-"+strconv.FormatInt(expiry.Unix(), 10))
+		for _, path := range []string{base + ".crt", base + ".key"} {
+			if err := os.WriteFile(path, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+			stale[path] = name == "expired"
+		}
+	}
+
+	// Two thirds of the leaf's validity have passed.
+	a.mu.Lock()
+	due := a.leaves[host]
+	due.NotBefore, due.NotAfter = time.Now().Add(-2*time.Hour), time.Now().Add(30*time.Minute)
+	a.leaves[host] = due
+	a.mu.Unlock()
+	if next := a.NextRotation(); next.After(time.Now()) {
+		t.Fatalf("NextRotation = %v, want it due", next)
+	}
+
+	rotated, err := a.Leaf(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCert := verify(t, a, rotated, host)
+	if newCert.SerialNumber.Cmp(oldCert.SerialNumber) == 0 {
+		t.Fatal("the due leaf was not replaced")
+	}
+	if !a.NextRotation().After(time.Now()) {
+		t.Errorf("NextRotation after rotating = %v, want it in the future", a.NextRotation())
+	}
+	for path, expired := range stale {
+		_, err := os.Stat(path)
+		if exists := err == nil; exists == expired {
+			t.Errorf("%s exists = %t, want %t", filepath.Base(path), exists, !expired)
+		}
+	}
+
+	// A host no route uses any more is no longer rotated.
+	a.Retain(map[string]bool{})
+	if next := a.NextRotation(); !next.IsZero() {
+		t.Errorf("NextRotation after Retain = %v, want zero", next)
+	}
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultPath is where the agent looks for its config when -config is not given.
+const DefaultPath = "/etc/polaredge/agent.json"
+
+// Config is the agent's on-disk configuration.
+type Config struct {
+	// BindAddress restricts every agent listener to one local address,
+	// e.g. the WireGuard address 10.88.0.1. Empty means all interfaces.
+	BindAddress string `json:"bindAddress"`
+	// BindInterface resolves the bind address from a network interface
+	// (e.g. "wg0"). It takes precedence over BindAddress.
+	BindInterface string `json:"bindInterface"`
+	SocketPort    int    `json:"socketPort"`
+	// PublicAddress binds the entrypoints of public routes. Empty means all
+	// interfaces.
+	PublicAddress string `json:"publicAddress"`
+	// PrivateAddress binds the entrypoints of private routes; PrivateInterface
+	// resolves it from an interface and takes precedence. Both default to the
+	// bind address, i.e. the WireGuard side.
+	PrivateAddress   string `json:"privateAddress"`
+	PrivateInterface string `json:"privateInterface"`
+	// APIPort serves the HTTP API on the bind address, see APIAddr. 0
+	// disables it.
+	APIPort int `json:"apiPort"`
+	// StateDir holds everything the agent persists between restarts.
+	StateDir string `json:"stateDir"`
+	// HistorySize is how many applied configs are kept for rollback.
+	HistorySize int `json:"historySize"`
+	// ControlSocket is the unix socket operator commands such as
+	// `polaredge-agent history rollback` talk to.
+	ControlSocket string `json:"controlSocket"`
+	// TraefikDir receives Traefik's static config and its dynamic/ directory.
+	TraefikDir string `json:"traefikDir"`
+	// DynamicDir overrides the directory of the routes, <traefikDir>/dynamic
+	// by default. DynamicFormat is "toml" or "yaml".
+	DynamicDir    string `json:"dynamicDir"`
+	DynamicFormat string `json:"dynamicFormat"`
+	// PingPort is the localhost port of Traefik's ping endpoint, used to
+	// health-check every config switch.
+	PingPort int `json:"pingPort"`
+	// ReloadSettle is how long Traefik gets to pick up a new config before it
+	// is checked; HealthTimeout bounds the ping check itself. A config that
+	// fails either is rolled back to the last known good one.
+	ReloadSettle  Duration `json:"reloadSettle"`
+	HealthTimeout Duration `json:"healthTimeout"`
+	// TraefikLogLevel is Traefik's log level (DEBUG, INFO, WARN, ERROR).
+	TraefikLogLevel string `json:"traefikLogLevel"`
+	// ListenPorts are the host ports routes may be served on, as single
+	// ports or ranges ("7000-7100"). A route asking for any other port, e.g.
+	// through a policy rule or a decision, is rejected.
+	ListenPorts []string `json:"listenPorts"`
+
+	// ExposurePolicy is the JSON file deciding which routes are exposed and
+	// how. It is reloaded when it changes.
+	ExposurePolicy string `json:"exposurePolicy"`
+	// InteractiveExposure holds high-port routes the policy has no rule for
+	// as pending and asks about them on stdin, one at a time. It needs a
+	// terminal; rendering does not wait for the answer.
+	InteractiveExposure bool `json:"interactiveExposure"`
+
+	// AckTimeout bounds how long a client waits for its manifest to be
+	// applied before it is told the manifest is still queued.
+	AckTimeout Duration `json:"ackTimeout"`
+	// MaxManifestBytes limits a manifest after decompression.
+	MaxManifestBytes int64 `json:"maxManifestBytes"`
+
+	// Keys lists every signing key currently accepted. Keeping the old and
+	// the new key listed side by side is how keys are rotated.
+	Keys         []KeyConfig `json:"keys"`
+	MaxClockSkew Duration    `json:"maxClockSkew"`
+
+	// ACME obtains certificates for public routes from an ACME CA.
+	ACME *ACMEConfig `json:"acme,omitempty"`
+	// InternalCA issues certificates for private routes from a local CA.
+	InternalCA *InternalCAConfig `json:"internalCA,omitempty"`
+	// BackendHealthCheck holds the defaults of the backends' health checks,
+	// which routes configure with polaredge.io/health-* annotations.
+	BackendHealthCheck HealthCheckConfig `json:"backendHealthCheck"`
+	// TrustedProxyDepth is how many proxies in front of Traefik (e.g. a
+	// cloud load balancer) IP allowlists skip in X-Forwarded-For. 0 uses
+	// the connection's address, which is the only safe choice without one.
+	TrustedProxyDepth int `json:"trustedProxyDepth"`
+	// Dashboard serves Traefik's API and dashboard on the private address.
+	// It is off without this block.
+	Dashboard *DashboardConfig `json:"dashboard,omitempty"`
+
+	// TLS switches the manifest socket to mutual TLS. Without it the socket
+	// speaks plain TCP and relies on WireGuard for encryption.
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// Clients restricts which identities may push manifests. The identity is
+	// the client certificate's SAN under TLS, or the envelope's client field.
+	Clients []ClientConfig `json:"clients,omitempty"`
+}
+
+// TLSConfig points at the PEM files used for mutual TLS. The files are
+// re-read when they change on disk.
+type TLSConfig struct {
+	CAFile   string `json:"caFile"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// ACMEConfig configures Traefik's ACME certificate resolver.
+type ACMEConfig struct {
+	Email string `json:"email"`
+	// CAServer is the ACME directory URL, Let's Encrypt when empty. Point it
+	// at Pebble (https://localhost:14000/dir) to test the whole flow.
+	CAServer string `json:"caServer"`
+	// CACertificates is a PEM bundle Traefik trusts for CAServer, e.g.
+	// Pebble's minica root.
+	CACertificates string `json:"caCertificates"`
+	// Storage is where Traefik keeps the account and certificates,
+	// <stateDir>/acme.json by default.
+	Storage string `json:"storage"`
+	// Challenge is "http-01" (default, needs port 80) or "tls-alpn-01"
+	// (needs port 443).
+	Challenge string `json:"challenge"`
+	// Default serves every public route over TLS unless it is annotated
+	// polaredge.io/tls: none.
+	Default bool `json:"default"`
+}
+
+// InternalCAConfig configures the agent's own CA.
+type InternalCAConfig struct {
+	// Dir holds the CA key and the issued certificates, <stateDir>/ca by
+	// default.
+	Dir string `json:"dir"`
+	// LeafValidity is how long issued certificates are valid (default 30
+	// days). They are rotated after two thirds of it.
+	LeafValidity Duration `json:"leafValidity"`
+	// Default serves every private route over TLS unless it is annotated
+	// polaredge.io/tls: none.
+	Default bool `json:"default"`
+}
+
+// HealthCheckConfig holds the health check settings routes fall back to.
+type HealthCheckConfig struct {
+	// Path checks every route's backends unless it is annotated
+	// polaredge.io/health-path: none. Empty leaves it to the annotation.
+	Path     string   `json:"path"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+	// Scheme is "http" or "https", the backend's scheme when empty.
+	Scheme string `json:"scheme"`
+	// Status is the status code a healthy backend answers, any 2xx or 3xx
+	// when 0.
+	Status int `json:"status"`
+}
+
+// DashboardConfig guards Traefik's dashboard with basic auth, an
+// allowlist, or both; at least one is required.
+type DashboardConfig struct {
+	// Port is the dashboard's port on the private address, 8080 by default.
+	Port int `json:"port"`
+	// Users are htpasswd lines ("admin:$apr1$..."); UsersFile is an
+	// htpasswd file Traefik reads.
+	Users     []string `json:"users,omitempty"`
+	UsersFile string   `json:"usersFile,omitempty"`
+	// AllowFrom lists the CIDRs or addresses that may reach the dashboard.
+	AllowFrom []string `json:"allowFrom,omitempty"`
+}
+
+// ClientConfig authorizes one client identity.
+type ClientConfig struct {
+	Identity string `json:"identity"`
+	// Keys limits which signing key ids this client may use. Empty allows any.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// KeyConfig describes one manifest signing key.
+type KeyConfig struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"alg"`                 // "hmac-sha256" or "ed25519"
+	Secret    string `json:"secret,omitempty"`    // base64 shared secret (hmac-sha256)
+	PublicKey string `json:"publicKey,omitempty"` // base64 public key (ed25519)
+	// NotAfter retires the key once a rotation has completed.
+	NotAfter *time.Time `json:"notAfter,omitempty"`
+}
+
+// Duration is a time.Duration that reads "30s" style strings from JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Default returns the configuration used when no file is present.
+func Default() *Config {
+	return &Config{
+		SocketPort:       9005,
+		APIPort:          9000,
+		StateDir:         "/var/lib/polaredge",
+		HistorySize:      20,
+		ControlSocket:    "/run/polaredge/agent.sock",
+		ExposurePolicy:   "/etc/polaredge/exposure.json",
+		TraefikDir:       "/etc/traefik",
+		DynamicFormat:    "toml",
+		PingPort:         8082,
+		ReloadSettle:     Duration{2 * time.Second},
+		HealthTimeout:    Duration{10 * time.Second},
+		TraefikLogLevel:  "INFO",
+		ListenPorts:      []string{"80", "443", "1024-65535"},
+		MaxManifestBytes: 32 << 20,
+		AckTimeout:       Duration{20 * time.Second},
+		MaxClockSkew:     Duration{5 * time.Minute},
+		BackendHealthCheck: HealthCheckConfig{
+			Interval: Duration{10 * time.Second},
+			Timeout:  Duration{5 * time.Second},
+		},
+	}
+}
+
+// Load reads the config file at path on top of the defaults. A missing file
+// at the default path is not an error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && path == DefaultPath {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ListenHost returns the host part every listener should bind to.
+func (c *Config) ListenHost() (string, error) {
+	if c.BindInterface == "" {
+		return c.BindAddress, nil
+	}
+	return interfaceIPv4(c.BindInterface)
+}
+
+// PrivateHost returns the address private routes are served on. It is empty
+// when no private address is known, in which case private routes cannot be
+// served.
+func (c *Config) PrivateHost() (string, error) {
+	switch {
+	case c.PrivateInterface != "":
+		return interfaceIPv4(c.PrivateInterface)
+	case c.PrivateAddress != "":
+		return c.PrivateAddress, nil
+	default:
+		return c.ListenHost()
+	}
+}
+
+func interfaceIPv4(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("interface %s: %w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("interface %s: %w", name, err)
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP.String(), nil
+		}
+	}
+	return "", fmt.Errorf("interface %s has no IPv4 address", name)
+}
+
+// SocketAddr returns the address of the manifest socket.
+func (c *Config) SocketAddr() (string, error) {
+	return c.listenAddr(c.SocketPort)
+}
+
+// APIAddr returns the address of the HTTP API. Without TLS its read
+// endpoints are unauthenticated, so it never binds every interface: it falls
+// back to the private address, then to localhost.
+func (c *Config) APIAddr() (string, error) {
+	host, err := c.ListenHost()
+	if err != nil || host != "" || c.TLS != nil {
+		return c.listenAddr(c.APIPort)
+	}
+	if host, err = c.PrivateHost(); err != nil {
+		return "", err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(c.APIPort)), nil
+}
+
+func (c *Config) listenAddr(port int) (string, error) {
+	host, err := c.ListenHost()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
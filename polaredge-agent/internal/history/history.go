@@ -0,0 +1,215 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"polaredge-agent/internal/fsutil"
+)
+
+// ErrNotFound is returned for a revision that is not (or no longer) kept.
+var ErrNotFound = errors.New("revision not found")
+
+// Entry describes one applied config.
+type Entry struct {
+	Revision  int64     `json:"revision"`
+	Timestamp time.Time `json:"timestamp"`
+	// Client is the source whose change produced this config: a client id,
+	// "intents", or "rollback".
+	Client string `json:"client"`
+	// Generations is the generation of every client's manifest in the config.
+	Generations map[string]int64 `json:"generations"`
+	// Summary is a short diff against the previous revision.
+	Summary string `json:"summary"`
+}
+
+// Revision is an entry with the config and manifests it was built from.
+type Revision struct {
+	Entry
+	StaticConfig  string                     `json:"staticConfig"`
+	DynamicConfig string                     `json:"dynamicConfig"`
+	Manifests     map[string]json.RawMessage `json:"manifests"`
+	// Routes maps each route (host and path) to its backend.
+	Routes map[string]string `json:"routes"`
+	// Exposed is the manager's detailed view of the routes.
+	Exposed json.RawMessage `json:"exposed,omitempty"`
+	// DynamicFormat is the format of DynamicConfig, toml when empty.
+	DynamicFormat string `json:"dynamicFormat,omitempty"`
+}
+
+// pin is persisted while a rollback is in effect.
+type pin struct {
+	Revision int64     `json:"revision"`
+	PinnedAt time.Time `json:"pinnedAt"`
+}
+
+// Store keeps the last revisions in a directory, one JSON file each.
+type Store struct {
+	dir  string
+	keep int
+
+	mu   sync.Mutex
+	last int64
+}
+
+// Open prepares a store in dir that keeps the newest keep revisions.
+func Open(dir string, keep int) (*Store, error) {
+	if keep <= 0 {
+		keep = 20
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create history dir: %w", err)
+	}
+	s := &Store{dir: dir, keep: keep}
+	revs, err := s.revisions()
+	if err != nil {
+		return nil, err
+	}
+	if len(revs) > 0 {
+		s.last = revs[len(revs)-1]
+	}
+	return s, nil
+}
+
+// Record stores rev under the next revision number and drops the oldest
+// revisions beyond the limit.
+func (s *Store) Record(rev Revision) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rev.Revision = s.last + 1
+	rev.Timestamp = time.Now()
+	data, err := json.MarshalIndent(rev, "", "  ")
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := fsutil.WriteFileAtomic(s.path(rev.Revision), data, 0600); err != nil {
+		return Entry{}, fmt.Errorf("write revision %d: %w", rev.Revision, err)
+	}
+	s.last = rev.Revision
+
+	revs, err := s.revisions()
+	if err != nil {
+		return rev.Entry, err
+	}
+	for len(revs) > s.keep {
+		_ = os.Remove(s.path(revs[0]))
+		revs = revs[1:]
+	}
+	return rev.Entry, nil
+}
+
+// List returns the kept entries, newest first.
+func (s *Store) List() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revs, err := s.revisions()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(revs))
+	for i := len(revs) - 1; i >= 0; i-- {
+		rev, err := s.read(revs[i])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, rev.Entry)
+	}
+	return entries, nil
+}
+
+// Latest returns the newest revision, or nil if none is kept.
+func (s *Store) Latest() (*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == 0 {
+		return nil, nil
+	}
+	return s.read(s.last)
+}
+
+// Get returns one revision.
+func (s *Store) Get(revision int64) (*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(revision)
+}
+
+// Pinned returns the revision a rollback pinned, or 0.
+func (s *Store) Pinned() int64 {
+	data, err := os.ReadFile(s.pinPath())
+	if err != nil {
+		return 0
+	}
+	var p pin
+	if err := json.Unmarshal(data, &p); err != nil {
+		return 0
+	}
+	return p.Revision
+}
+
+// Pin records that revision stays in effect until Unpin.
+func (s *Store) Pin(revision int64) error {
+	data, err := json.Marshal(pin{Revision: revision, PinnedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(s.pinPath(), data, 0600)
+}
+
+// Unpin lifts a rollback pin. It is not an error if none is set.
+func (s *Store) Unpin() error {
+	if err := os.Remove(s.pinPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) read(revision int64) (*Revision, error) {
+	data, err := os.ReadFile(s.path(revision))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %d", ErrNotFound, revision)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rev Revision
+	if err := json.Unmarshal(data, &rev); err != nil {
+		return nil, fmt.Errorf("parse revision %d: %w", revision, err)
+	}
+	return &rev, nil
+}
+
+// revisions lists the stored revision numbers in ascending order.
+func (s *Store) revisions() ([]int64, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read history dir: %w", err)
+	}
+	var revs []int64
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".json")
+		if rev, err := strconv.ParseInt(name, 10, 64); err == nil && name != f.Name() {
+			revs = append(revs, rev)
+		}
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i] < revs[j] })
+	return revs, nil
+}
+
+func (s *Store) path(revision int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.json", revision))
+}
+
+func (s *Store) pinPath() string {
+	return filepath.Join(s.dir, "pinned.json")
+}
@@ -0,0 +1,104 @@
+package history
+
+import (
+	"errors"
+	"testing"
+)
+
+func record(t *testing.T, s *Store, client, static string) Entry {
+	t.Helper()
+	entry, err := s.Record(Revision{Entry: Entry{Client: client}, StaticConfig: static})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestStoreKeepsNewestRevisions(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest, err := s.Latest(); latest != nil || err != nil {
+		t.Fatalf("Latest of an empty store = %v, %v", latest, err)
+	}
+	for i, client := range []string{"c1", "c2", "c1", "intents", "c2"} {
+		if entry := record(t, s, client, client); entry.Revision != int64(i+1) {
+			t.Fatalf("revision %d recorded as %d", i+1, entry.Revision)
+		}
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revs []int64
+	for _, e := range entries {
+		revs = append(revs, e.Revision)
+	}
+	if len(revs) != 3 || revs[0] != 5 || revs[2] != 3 {
+		t.Fatalf("kept revisions %v, want [5 4 3]", revs)
+	}
+	if _, err := s.Get(2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a dropped revision = %v, want ErrNotFound", err)
+	}
+	if rev, err := s.Get(4); err != nil || rev.Client != "intents" || rev.StaticConfig != "intents" {
+		t.Fatalf("Get(4) = %+v, %v", rev, err)
+	}
+
+	// Numbering carries on after a restart, so revisions stay unique.
+	reopened, err := Open(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := record(t, reopened, "c1", "c1"); entry.Revision != 6 {
+		t.Fatalf("first revision after reopen = %d, want 6", entry.Revision)
+	}
+	if latest, err := reopened.Latest(); err != nil || latest.Revision != 6 {
+		t.Fatalf("Latest = %+v, %v, want revision 6", latest, err)
+	}
+}
+
+func TestPinSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record(t, s, "c1", "first")
+	record(t, s, "c1", "second")
+	if s.Pinned() != 0 {
+		t.Fatalf("Pinned = %d before any rollback", s.Pinned())
+	}
+	if err := s.Pin(1); err != nil {
+		t.Fatal(err)
+	}
+	// The rollback itself is recorded as a new revision; the pin stays on
+	// the revision rolled back to.
+	record(t, s, "rollback", "first")
+
+	reopened, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Pinned() != 1 {
+		t.Fatalf("Pinned after reopen = %d, want 1", reopened.Pinned())
+	}
+	entries, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("the pin file was listed as a revision: %+v", entries)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := reopened.Unpin(); err != nil {
+			t.Fatalf("Unpin %d: %v", i+1, err)
+		}
+	}
+	if reopened.Pinned() != 0 {
+		t.Fatalf("Pinned after Unpin = %d", reopened.Pinned())
+	}
+}
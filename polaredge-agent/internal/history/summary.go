@@ -0,0 +1,53 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxListed bounds the routes named in a summary.
+const maxListed = 5
+
+// Summarize describes the route changes from before to after, e.g.
+// "1 added, 1 removed: +a.example.com/ -b.example.com/api".
+func Summarize(before, after map[string]string) string {
+	var added, removed, changed []string
+	for route, backend := range after {
+		old, ok := before[route]
+		switch {
+		case !ok:
+			added = append(added, route)
+		case old != backend:
+			changed = append(changed, route)
+		}
+	}
+	for route := range before {
+		if _, ok := after[route]; !ok {
+			removed = append(removed, route)
+		}
+	}
+	if len(added)+len(removed)+len(changed) == 0 {
+		return "no route changes"
+	}
+
+	var counts, names []string
+	for _, group := range []struct {
+		routes []string
+		verb   string
+		sign   string
+	}{{added, "added", "+"}, {removed, "removed", "-"}, {changed, "changed", "~"}} {
+		if len(group.routes) == 0 {
+			continue
+		}
+		sort.Strings(group.routes)
+		counts = append(counts, fmt.Sprintf("%d %s", len(group.routes), group.verb))
+		for _, route := range group.routes {
+			names = append(names, group.sign+route)
+		}
+	}
+	if len(names) > maxListed {
+		names = append(names[:maxListed], fmt.Sprintf("and %d more", len(names)-maxListed))
+	}
+	return strings.Join(counts, ", ") + ": " + strings.Join(names, " ")
+}
@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"polaredge-agent/internal/policy"
+	"polaredge-agent/internal/renderer"
+)
+
+// Annotations restricting a route's clients to, or excluding, comma-separated
+// CIDRs or addresses. Access rules of the exposure policy take precedence: a
+// rule's allowlist replaces the annotation's and its denylist is added.
+const (
+	IPAllowListAnnotation = "polaredge.io/ip-allowlist"
+	IPDenyListAnnotation  = "polaredge.io/ip-denylist"
+)
+
+// withAccess sets the route's allowlist, denylist and trusted proxy depth
+// from its annotations and the policy's access rules.
+func (m *Manager) withAccess(ing renderer.Ingress) (renderer.Ingress, error) {
+	allow, err := policy.ParseCIDRs(strings.Split(ing.Annotations[IPAllowListAnnotation], ","))
+	if err != nil {
+		return ing, fmt.Errorf("%s: %w", IPAllowListAnnotation, err)
+	}
+	deny, err := policy.ParseCIDRs(strings.Split(ing.Annotations[IPDenyListAnnotation], ","))
+	if err != nil {
+		return ing, fmt.Errorf("%s: %w", IPDenyListAnnotation, err)
+	}
+	ing.ProxyDepth = m.proxyDepth
+
+	if rule, ok := m.policy.Policy().Access(ing); ok {
+		if len(rule.Allow) > 0 {
+			if len(allow) > 0 && strings.Join(allow, ",") != strings.Join(rule.Allow, ",") {
+				log.Printf("📜 %s%s: %s replaced by access rule %q", ing.Host, ing.Path, IPAllowListAnnotation, rule.Name)
+			}
+			allow = rule.Allow
+		}
+		// Both lists are valid already.
+		deny, _ = policy.ParseCIDRs(append(deny, rule.Deny...))
+		if rule.ProxyDepth != nil {
+			ing.ProxyDepth = *rule.ProxyDepth
+		}
+	}
+	// ClientIP only sees the connection's address, which behind proxies is
+	// the proxy's.
+	if len(deny) > 0 && ing.ProxyDepth > 0 {
+		return ing, fmt.Errorf("a denylist cannot be enforced behind trusted proxies (depth %d), use an allowlist", ing.ProxyDepth)
+	}
+	ing.AllowFrom, ing.DenyFrom = allow, deny
+	return ing, nil
+}
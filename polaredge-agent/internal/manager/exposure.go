@@ -0,0 +1,34 @@
+package manager
+
+import (
+	"log"
+
+	"polaredge-agent/internal/policy"
+)
+
+// Decisions returns the stored exposure decisions.
+func (m *Manager) Decisions() []policy.Record {
+	return m.decisions.List()
+}
+
+// SetDecision stores an operator's exposure decision and renders again.
+func (m *Manager) SetDecision(r policy.Record) error {
+	if err := m.decisions.Set(r); err != nil {
+		return err
+	}
+	log.Printf("🧭 %s set %s to %s", r.DecidedBy, r.Key(), r.Mode)
+	m.trigger()
+	return nil
+}
+
+// RevokeDecision removes the decision for host and port, handing the route
+// back to the exposure policy.
+func (m *Manager) RevokeDecision(host string, port int) (bool, error) {
+	ok, err := m.decisions.Revoke(host, port)
+	if err != nil || !ok {
+		return ok, err
+	}
+	log.Printf("🧭 Exposure decision for %s:%d revoked", host, port)
+	m.trigger()
+	return true, nil
+}
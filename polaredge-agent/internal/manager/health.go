@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"polaredge-agent/internal/renderer"
+)
+
+// Annotations configuring the health check of a route's backends. The path
+// turns it on ("none" turns off the agent's default); the others override the
+// agent's defaults.
+const (
+	HealthPathAnnotation     = "polaredge.io/health-path"
+	HealthIntervalAnnotation = "polaredge.io/health-interval"
+	HealthTimeoutAnnotation  = "polaredge.io/health-timeout"
+	HealthSchemeAnnotation   = "polaredge.io/health-scheme"
+	HealthStatusAnnotation   = "polaredge.io/health-status"
+)
+
+// healthCheck builds the health check of a route from its annotations on top
+// of the agent's defaults. It is nil when neither sets a path.
+func (m *Manager) healthCheck(ing renderer.Ingress) (*renderer.HealthCheck, error) {
+	hc := m.backendHealth
+	if v, ok := ing.Annotations[HealthPathAnnotation]; ok {
+		hc.Path = v
+	}
+	if hc.Path == "" || hc.Path == "none" {
+		for _, a := range []string{HealthIntervalAnnotation, HealthTimeoutAnnotation, HealthSchemeAnnotation, HealthStatusAnnotation} {
+			if _, ok := ing.Annotations[a]; ok && hc.Path == "" {
+				return nil, fmt.Errorf("%s needs %s", a, HealthPathAnnotation)
+			}
+		}
+		return nil, nil
+	}
+
+	if v := ing.Annotations[HealthIntervalAnnotation]; v != "" {
+		hc.Interval = v
+	}
+	if v := ing.Annotations[HealthTimeoutAnnotation]; v != "" {
+		hc.Timeout = v
+	}
+	if v := ing.Annotations[HealthSchemeAnnotation]; v != "" {
+		hc.Scheme = v
+	}
+	if v := ing.Annotations[HealthStatusAnnotation]; v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q is not a number", HealthStatusAnnotation, v)
+		}
+		hc.Status = status
+	}
+	if err := checkHealthCheck(&hc); err != nil {
+		return nil, err
+	}
+	return &hc, nil
+}
+
+// checkHealthCheck validates hc and normalizes its durations.
+func checkHealthCheck(hc *renderer.HealthCheck) error {
+	if hc.Path != "" && hc.Path != "none" && !strings.HasPrefix(hc.Path, "/") {
+		return fmt.Errorf("health check path %q must start with /", hc.Path)
+	}
+	switch hc.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("health check scheme %q must be http or https", hc.Scheme)
+	}
+	if hc.Status != 0 && (hc.Status < 100 || hc.Status > 599) {
+		return fmt.Errorf("health check status %d is not an HTTP status", hc.Status)
+	}
+
+	var interval, timeout time.Duration
+	for _, d := range []struct {
+		name  string
+		value *string
+		out   *time.Duration
+	}{
+		{"interval", &hc.Interval, &interval},
+		{"timeout", &hc.Timeout, &timeout},
+	} {
+		if *d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(*d.value)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("health check %s %q must be a positive duration like \"10s\"", d.name, *d.value)
+		}
+		*d.value, *d.out = v.String(), v
+	}
+	if interval > 0 && timeout > interval {
+		return fmt.Errorf("health check timeout %s is longer than its interval %s", hc.Timeout, hc.Interval)
+	}
+	return nil
+}
@@ -2,10 +2,16 @@ package manager
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
+
+	"polaredge-agent/internal/fsutil"
+	"polaredge-agent/internal/renderer"
 )
 
 type IngressIntent struct {
@@ -29,12 +35,28 @@ type RouteStatus struct {
 	Timestamp string `json:"timestamp"`
 }
 
-func HandleIngressIntent(w http.ResponseWriter, r *http.Request) {
+// HandleIngressIntent stores a single-route intent and schedules a render.
+// Callers are expected to have authenticated the request already.
+func (m *Manager) HandleIngressIntent(w http.ResponseWriter, r *http.Request) {
 	var intent IngressIntent
 	if err := json.NewDecoder(r.Body).Decode(&intent); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if intent.RouteID == "" || intent.Host == "" || intent.Port <= 0 || intent.Port > 65535 {
+		http.Error(w, "routeID, host and a valid port are required", http.StatusUnprocessableEntity)
+		return
+	}
+	// The route ID doubles as the backend's hostname, so it is held to the
+	// same rules the render applies, rather than being dropped there.
+	if err := checkHost(intent.RouteID); err != nil {
+		http.Error(w, fmt.Sprintf("routeID %q must be a DNS name: it is the backend's hostname", intent.RouteID), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := checkRoute(intent.ingress()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 
 	status := RouteStatus{
 		RouteID:   intent.RouteID,
@@ -46,18 +68,66 @@ func HandleIngressIntent(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
 
-	statusFile := filepath.Join("status", "status.json")
-	file, err := os.Create(statusFile)
+	m.mu.Lock()
+	m.intents[intent.RouteID] = intent
+	err := m.saveIntentsLocked()
+	m.mu.Unlock()
 	if err != nil {
-		http.Error(w, "Failed to write status", http.StatusInternalServerError)
+		http.Error(w, "Failed to store intent", http.StatusInternalServerError)
 		return
 	}
-	defer file.Close()
-
-	enc := json.NewEncoder(file)
-	enc.SetIndent("", "  ")
-	_ = enc.Encode([]RouteStatus{status})
+	m.unpin(fmt.Sprintf("intent %q", intent.RouteID))
+	m.trigger()
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	_ = json.NewEncoder(w).Encode(status)
 }
+
+// ingress converts the intent into a route for the renderer.
+func (i IngressIntent) ingress() renderer.Ingress {
+	return renderer.Ingress{Host: i.Host, ServiceName: i.RouteID, ServicePort: i.Port}
+}
+
+func (m *Manager) intentsPath() string {
+	return filepath.Join(m.stateDir, "intents.json")
+}
+
+func (m *Manager) loadIntents() error {
+	data, err := os.ReadFile(m.intentsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read intents: %w", err)
+	}
+
+	var intents []IngressIntent
+	if err := json.Unmarshal(data, &intents); err != nil {
+		return fmt.Errorf("parse %s: %w", m.intentsPath(), err)
+	}
+	for _, intent := range intents {
+		m.intents[intent.RouteID] = intent
+	}
+	return nil
+}
+
+func (m *Manager) saveIntentsLocked() error {
+	if err := os.MkdirAll(m.stateDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m.intentsLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(m.intentsPath(), data, 0644)
+}
+
+func (m *Manager) intentsLocked() []IngressIntent {
+	intents := make([]IngressIntent, 0, len(m.intents))
+	for _, intent := range m.intents {
+		intents = append(intents, intent)
+	}
+	sort.Slice(intents, func(i, j int) bool { return intents[i].RouteID < intents[j].RouteID })
+	return intents
+}
@@ -0,0 +1,959 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"polaredge-agent/internal/ca"
+	"polaredge-agent/internal/fsutil"
+	"polaredge-agent/internal/history"
+	"polaredge-agent/internal/policy"
+	"polaredge-agent/internal/protocol"
+	"polaredge-agent/internal/renderer"
+	"polaredge-agent/internal/traefik"
+)
+
+// policyPollInterval is how often the exposure policy file is checked.
+const policyPollInterval = 5 * time.Second
+
+// Source is the latest manifest received from one client.
+type Source struct {
+	Client            string          `json:"client"`
+	Generation        int64           `json:"generation"`
+	AppliedGeneration int64           `json:"appliedGeneration"`
+	ReceivedAt        time.Time       `json:"receivedAt"`
+	Manifest          json.RawMessage `json:"manifest"`
+	// AppliedManifest is the manifest of AppliedGeneration, which lags
+	// Manifest while a newer generation is queued.
+	AppliedManifest json.RawMessage `json:"appliedManifest,omitempty"`
+	// FailedGeneration is the last generation whose apply failed, with Error.
+	FailedGeneration int64  `json:"failedGeneration,omitempty"`
+	Error            string `json:"error,omitempty"`
+
+	ingresses []renderer.Ingress
+}
+
+// State is a point-in-time view of what the agent holds and has applied.
+type State struct {
+	Sources       []Source        `json:"sources"`
+	Intents       []IngressIntent `json:"intents"`
+	StaticConfig  string          `json:"staticConfig"`
+	DynamicConfig string          `json:"dynamicConfig"`
+	LastApply     *time.Time      `json:"lastApply,omitempty"`
+	LastError     string          `json:"lastError,omitempty"`
+	// PinnedRevision is set while a rollback holds the config.
+	PinnedRevision int64 `json:"pinnedRevision,omitempty"`
+	// Pending lists routes waiting for an operator's approval.
+	Pending []PendingRoute `json:"pending"`
+	// Rejected lists routes left out as invalid or conflicting.
+	Rejected []RejectedRoute `json:"rejected"`
+	// Routes lists the routes Traefik serves and where.
+	Routes []ExposedRoute `json:"routes"`
+	// ConfigHash identifies the config Traefik runs with.
+	ConfigHash string `json:"configHash,omitempty"`
+	// Dashboard is the URL of Traefik's dashboard when it is enabled.
+	Dashboard string `json:"dashboard,omitempty"`
+}
+
+// ExposedRoute is a route in the applied config.
+type ExposedRoute struct {
+	Host string `json:"host"`
+	Path string `json:"path,omitempty"`
+	// Port is the host port the route listens on, BackendPort the port
+	// traffic is forwarded to.
+	Port        int    `json:"port"`
+	BackendPort int    `json:"backendPort"`
+	Exposure    string `json:"exposure"`
+	TLS         string `json:"tls,omitempty"`
+	EntryPoint  string `json:"entryPoint"`
+	Address     string `json:"address"`
+	Namespace   string `json:"namespace,omitempty"`
+	ServiceName string `json:"serviceName"`
+	Source      string `json:"source"`
+	// AllowFrom and DenyFrom are the route's client address restrictions.
+	AllowFrom []string `json:"allowFrom,omitempty"`
+	DenyFrom  []string `json:"denyFrom,omitempty"`
+}
+
+// Options configures a Manager.
+type Options struct {
+	// TraefikDir receives traefik.toml (static) and dynamic/ (file provider).
+	TraefikDir string
+	StateDir   string
+	// AckTimeout bounds how long Submit waits for a manifest to be applied.
+	AckTimeout time.Duration
+	Supervisor *traefik.Supervisor
+	// DynamicDir overrides the file provider's directory. DynamicFormat is
+	// "toml" (default) or "yaml".
+	DynamicDir    string
+	DynamicFormat string
+	// PingPort is Traefik's localhost ping port. ReloadSettle and
+	// HealthTimeout bound the check run after every config switch.
+	PingPort      int
+	ReloadSettle  time.Duration
+	HealthTimeout time.Duration
+	// LogLevel is written to Traefik's static config.
+	LogLevel string
+	// HistorySize is how many applied configs are kept for rollback.
+	HistorySize int
+	// Policy decides which routes are exposed and how. Routes it has no rule
+	// for are asked about on stdin when Interactive is set.
+	Policy      *policy.File
+	Interactive bool
+	// Decisions are per-route operator decisions; they override Policy.
+	Decisions *policy.Decisions
+	// PublicAddress and PrivateAddress bind public and private entrypoints.
+	// Private routes are left out while PrivateAddress is empty.
+	PublicAddress  string
+	PrivateAddress string
+	// PortMin and PortMax bound the dedicated listen ports handed out to
+	// routes that ask for one.
+	PortMin int
+	PortMax int
+	// ACME enables the ACME certificate resolver. With ACMEDefault, public
+	// routes use it unless annotated otherwise.
+	ACME        *renderer.ACMEOptions
+	ACMEDefault bool
+	// CA issues certificates for internal TLS. With CADefault, private routes
+	// use it unless annotated otherwise.
+	CA        *ca.Authority
+	CADefault bool
+	// BackendHealth holds the defaults of the backend health checks. With a
+	// Path, every route is checked unless annotated otherwise.
+	BackendHealth renderer.HealthCheck
+	// ProxyDepth is how many trusted proxies in front of Traefik IP
+	// allowlists skip in X-Forwarded-For; 0 uses the connection's address.
+	ProxyDepth int
+	// Dashboard enables Traefik's API and dashboard, nil leaves it off.
+	Dashboard *renderer.DashboardOptions
+	// ReservedPorts are host ports no route may listen on, e.g. ssh and the
+	// agent's own listeners.
+	ReservedPorts []int
+	// ListenPorts are the host ports routes may listen on; empty allows any.
+	ListenPorts []policy.PortRange
+}
+
+// Manager merges manifests from every client and single-route intents into
+// one route set, and renders it to Traefik in the background.
+type Manager struct {
+	traefikDir string
+	stateDir   string
+	ackTimeout time.Duration
+	supervisor *traefik.Supervisor
+
+	// routesDir overrides <traefikDir>/dynamic, see dynamicDir.
+	routesDir string
+	format    string
+
+	pingPort      int
+	reloadSettle  time.Duration
+	healthTimeout time.Duration
+	logLevel      string
+
+	history     *history.Store
+	policy      *policy.File
+	interactive bool
+	// prompts queues new pending routes for promptPending.
+	prompts     chan string
+	decisions   *policy.Decisions
+	publicAddr  string
+	privateAddr string
+	// ports is only used while rendering, under applyMu.
+	ports       *portAllocator
+	acme        *renderer.ACMEOptions
+	acmeDefault bool
+	ca          *ca.Authority
+	caDefault   bool
+	// backendHealth holds the health check defaults, see healthCheck.
+	backendHealth renderer.HealthCheck
+	proxyDepth    int
+	dashboard     *renderer.DashboardOptions
+	reservedPorts map[int]bool
+	listenPorts   []policy.PortRange
+	// applyMu serializes config switches: renders and rollbacks.
+	applyMu sync.Mutex
+
+	mu       sync.Mutex
+	sources  map[string]*Source
+	intents  map[string]IngressIntent
+	static   string
+	rendered string
+	// hash identifies the applied config, see configHash.
+	hash string
+	// routes describes the applied routes, for history summaries.
+	routes map[string]string
+	// pending holds the routes waiting for approval, by host:port.
+	pending map[string]PendingRoute
+	// rejected lists the routes the last render left out, and why.
+	rejected rejections
+	// exposed lists the routes of the applied config.
+	exposed []ExposedRoute
+	// lkgStatic and lkgDynamic are the last config Traefik accepted.
+	lkgStatic  string
+	lkgDynamic string
+	lastApply  time.Time
+	lastError  string
+
+	dirty chan struct{}
+	// applied is closed and replaced after every apply attempt.
+	applied chan struct{}
+}
+
+// New creates a manager and restores the client sources and intents stored in
+// the state dir.
+func New(opts Options) (*Manager, error) {
+	m := &Manager{
+		traefikDir: opts.TraefikDir,
+		stateDir:   opts.StateDir,
+		ackTimeout: opts.AckTimeout,
+		supervisor: opts.Supervisor,
+
+		routesDir: opts.DynamicDir,
+		format:    opts.DynamicFormat,
+
+		acme:        opts.ACME,
+		acmeDefault: opts.ACMEDefault,
+		ca:          opts.CA,
+		caDefault:   opts.CADefault,
+
+		backendHealth: opts.BackendHealth,
+		proxyDepth:    opts.ProxyDepth,
+		dashboard:     opts.Dashboard,
+		reservedPorts: make(map[int]bool),
+		listenPorts:   opts.ListenPorts,
+
+		pingPort:      opts.PingPort,
+		reloadSettle:  opts.ReloadSettle,
+		healthTimeout: opts.HealthTimeout,
+		logLevel:      opts.LogLevel,
+		policy:        opts.Policy,
+		interactive:   opts.Interactive,
+		prompts:       make(chan string, 64),
+		decisions:     opts.Decisions,
+		publicAddr:    opts.PublicAddress,
+		privateAddr:   opts.PrivateAddress,
+
+		sources: make(map[string]*Source),
+		intents: make(map[string]IngressIntent),
+		dirty:   make(chan struct{}, 1),
+		applied: make(chan struct{}),
+	}
+	if m.format == "" {
+		m.format = renderer.FormatTOML
+	}
+	if err := renderer.CheckFormat(m.format); err != nil {
+		return nil, err
+	}
+	if err := renderer.CheckAddresses(m.publicAddr, m.privateAddr); err != nil {
+		return nil, err
+	}
+	if err := checkHealthCheck(&m.backendHealth); err != nil {
+		return nil, fmt.Errorf("backend health check defaults: %w", err)
+	}
+	for _, port := range opts.ReservedPorts {
+		m.reservedPorts[port] = true
+	}
+	if m.proxyDepth < 0 {
+		return nil, fmt.Errorf("trusted proxy depth %d is negative", m.proxyDepth)
+	}
+	if err := m.loadSources(); err != nil {
+		return nil, err
+	}
+	if err := m.loadIntents(); err != nil {
+		return nil, err
+	}
+	store, err := history.Open(filepath.Join(m.stateDir, "history"), opts.HistorySize)
+	if err != nil {
+		return nil, err
+	}
+	m.history = store
+	if m.ports, err = openPorts(filepath.Join(m.stateDir, "listen-ports.json"), opts.PortMin, opts.PortMax); err != nil {
+		return nil, err
+	}
+	if latest, err := store.Latest(); err == nil && latest != nil {
+		m.routes = latest.Routes
+		_ = json.Unmarshal(latest.Exposed, &m.exposed)
+	}
+	if data, err := os.ReadFile(m.StaticConfigPath()); err == nil {
+		m.static = string(data)
+	}
+	m.hash = m.diskHash()
+	if data, err := os.ReadFile(filepath.Join(m.lkgDir(), "traefik.toml")); err == nil {
+		m.lkgStatic = string(data)
+	}
+	if data, err := os.ReadFile(filepath.Join(m.lkgDir(), m.dynamicFileName())); err == nil {
+		m.lkgDynamic = string(data)
+	}
+	return m, nil
+}
+
+// StaticConfigPath is the file Traefik is started with.
+func (m *Manager) StaticConfigPath() string {
+	return filepath.Join(m.traefikDir, "traefik.toml")
+}
+
+func (m *Manager) dynamicDir() string {
+	if m.routesDir != "" {
+		return m.routesDir
+	}
+	return filepath.Join(m.traefikDir, "dynamic")
+}
+
+func (m *Manager) dynamicFileName() string {
+	return "polaredge." + m.format
+}
+
+func (m *Manager) dynamicConfigPath() string {
+	return filepath.Join(m.dynamicDir(), m.dynamicFileName())
+}
+
+// removeStaleDynamic deletes a dynamic config left in the other format, which
+// the file provider would otherwise merge with the current one.
+func (m *Manager) removeStaleDynamic() {
+	for _, format := range []string{renderer.FormatTOML, renderer.FormatYAML} {
+		if format == m.format {
+			continue
+		}
+		stale := filepath.Join(m.dynamicDir(), "polaredge."+format)
+		if err := os.Remove(stale); err == nil {
+			log.Printf("🧹 Removed %s, the dynamic config is now written as %s", stale, m.format)
+		}
+	}
+}
+
+// lkgDir keeps a copy of the last config Traefik accepted.
+func (m *Manager) lkgDir() string {
+	return filepath.Join(m.stateDir, "lkg")
+}
+
+func (m *Manager) pingURL() string {
+	return fmt.Sprintf("http://127.0.0.1:%d/ping", m.pingPort)
+}
+
+// Start brings up Traefik with the config left by a previous run, if any, so
+// routes keep being served while clients reconnect.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	haveStatic := m.static != ""
+	m.mu.Unlock()
+	if haveStatic {
+		m.supervisor.Start()
+	}
+	go m.policy.Watch(policyPollInterval, m.trigger)
+	go m.decisions.Watch(policyPollInterval, m.trigger)
+	if m.interactive {
+		go m.promptPending()
+	}
+	if m.ca != nil {
+		go m.rotateCertificates()
+	}
+}
+
+// Submit records a verified envelope, schedules a render and waits until the
+// generation is applied, fails, or the ack timeout passes. Resending a
+// generation that is already known does not render it again.
+func (m *Manager) Submit(env *protocol.Envelope) protocol.Ack {
+	var ingresses []renderer.Ingress
+	if err := json.Unmarshal(env.Manifest, &ingresses); err != nil {
+		return protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonBadManifest, Generation: env.Generation, Error: fmt.Sprintf("unmarshal ingress list: %v", err)}
+	}
+
+	m.mu.Lock()
+	src, ok := m.sources[env.Client]
+	if !ok {
+		src = &Source{Client: env.Client}
+		m.sources[env.Client] = src
+	}
+	resend := ok && src.Generation == env.Generation
+	retry := resend && src.FailedGeneration >= env.Generation
+	if !resend {
+		src.Generation = env.Generation
+		src.ReceivedAt = time.Now()
+		src.Manifest = env.Manifest
+		src.ingresses = ingresses
+	}
+	if retry {
+		src.FailedGeneration = 0
+		src.Error = ""
+	}
+	if !resend || retry {
+		if err := m.saveSourcesLocked(); err != nil {
+			log.Printf("⚠️  Could not save the manifest of %q: %v", env.Client, err)
+		}
+	}
+	m.mu.Unlock()
+
+	switch {
+	case retry:
+		log.Printf("📥 Manifest generation %d from %q resent after a failed apply, retrying", env.Generation, env.Client)
+		m.trigger()
+	case resend:
+		log.Printf("📥 Manifest generation %d from %q resent", env.Generation, env.Client)
+	default:
+		log.Printf("📥 Manifest generation %d from %q (%d routes)", env.Generation, env.Client, len(ingresses))
+		m.unpin(fmt.Sprintf("generation %d from %q", env.Generation, env.Client))
+		m.trigger()
+	}
+	return m.waitApplied(env.Client, env.Generation)
+}
+
+func (m *Manager) waitApplied(client string, generation int64) protocol.Ack {
+	timeout := time.After(m.ackTimeout)
+	for {
+		m.mu.Lock()
+		src := *m.sources[client]
+		applied := m.applied
+		pending := m.pendingForLocked(client)
+		rejected := m.rejectedForLocked(client)
+		hash := m.hash
+		m.mu.Unlock()
+
+		ack := protocol.Ack{Generation: generation, AppliedGeneration: src.AppliedGeneration, Pending: pending, Rejected: rejected, ConfigHash: hash}
+		switch {
+		case src.AppliedGeneration >= generation:
+			ack.Status = protocol.AckApplied
+			return ack
+		case src.FailedGeneration >= generation:
+			ack.Status = protocol.AckRejected
+			ack.Reason = protocol.ReasonApplyFailed
+			ack.Error = src.Error
+			return ack
+		case src.Generation != generation:
+			// Superseded by a newer manifest before it was applied.
+			ack.Status = protocol.AckRejected
+			ack.Reason = protocol.ReasonSuperseded
+			ack.Error = fmt.Sprintf("superseded by generation %d", src.Generation)
+			return ack
+		}
+
+		select {
+		case <-applied:
+		case <-timeout:
+			ack.Status = protocol.AckQueued
+			return ack
+		}
+	}
+}
+
+// Run renders the merged route set every time it changes. It never returns.
+func (m *Manager) Run() {
+	for range m.dirty {
+		m.apply()
+	}
+}
+
+// State returns a copy of the current state.
+func (m *Manager) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := State{
+		Sources:       []Source{},
+		StaticConfig:  m.StaticConfigPath(),
+		DynamicConfig: m.dynamicConfigPath(),
+		LastError:     m.lastError,
+	}
+	if !m.lastApply.IsZero() {
+		t := m.lastApply
+		st.LastApply = &t
+	}
+	for _, client := range m.clientsLocked() {
+		st.Sources = append(st.Sources, *m.sources[client])
+	}
+	st.Intents = m.intentsLocked()
+	st.PinnedRevision = m.history.Pinned()
+	st.Pending = m.pendingLocked()
+	st.Rejected = append([]RejectedRoute{}, m.rejected...)
+	st.Routes = append([]ExposedRoute{}, m.exposed...)
+	st.ConfigHash = m.hash
+	if m.dashboard != nil {
+		st.Dashboard = "http://" + m.dashboard.Address + "/dashboard/"
+	}
+	return st
+}
+
+// Source returns the latest manifest received from client.
+func (m *Manager) Source(client string) (Source, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	src, ok := m.sources[client]
+	if !ok {
+		return Source{}, false
+	}
+	return *src, true
+}
+
+// RenderedConfig returns the last static and dynamic config written for Traefik.
+func (m *Manager) RenderedConfig() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rendered == "" {
+		return ""
+	}
+	return fmt.Sprintf("# %s\n%s\n# %s\n%s", m.StaticConfigPath(), m.static, m.dynamicConfigPath(), m.rendered)
+}
+
+func (m *Manager) trigger() {
+	select {
+	case m.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) apply() {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	if rev := m.history.Pinned(); rev != 0 {
+		log.Printf("📌 Pinned to revision %d, not rendering until the next manifest or unpin", rev)
+		m.mu.Lock()
+		m.notifyLocked()
+		m.mu.Unlock()
+		return
+	}
+
+	m.mu.Lock()
+	var ingresses []renderer.Ingress
+	var changed []string
+	generations := make(map[string]int64)
+	manifests := make(map[string]json.RawMessage)
+	for _, client := range m.clientsLocked() {
+		src := m.sources[client]
+		for _, ing := range src.ingresses {
+			ing.Source = client
+			ingresses = append(ingresses, ing)
+		}
+		generations[client] = src.Generation
+		manifests[client] = src.Manifest
+		if src.Generation != src.AppliedGeneration {
+			changed = append(changed, client)
+		}
+	}
+	intents := m.intentsLocked()
+	for _, intent := range intents {
+		ing := intent.ingress()
+		ing.Source = "intent:" + intent.RouteID
+		ingresses = append(ingresses, ing)
+	}
+	m.mu.Unlock()
+	if len(intents) > 0 {
+		manifests["intents"], _ = json.Marshal(intents)
+	}
+	if len(changed) == 0 && len(intents) > 0 {
+		changed = []string{"intents"}
+	}
+	if len(changed) == 0 {
+		changed = []string{"agent"}
+	}
+
+	cfg, err := m.render(ingresses)
+	changedConfig := false
+	if err == nil {
+		m.updatePending(cfg.pending)
+		m.updateRejected(cfg.rejected)
+		changedConfig, err = m.install(cfg)
+	}
+	if changedConfig {
+		m.recordHistory(history.Revision{
+			Entry:     history.Entry{Client: strings.Join(changed, ","), Generations: generations},
+			Manifests: manifests,
+		}, cfg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.notifyLocked()
+	defer m.saveAppliedLocked()
+	if err != nil {
+		m.lastError = err.Error()
+		log.Printf("❌ %v", err)
+		for client, gen := range generations {
+			if src, ok := m.sources[client]; ok && src.AppliedGeneration < gen {
+				src.FailedGeneration = gen
+				src.Error = err.Error()
+			}
+		}
+		return
+	}
+	for client, gen := range generations {
+		if src, ok := m.sources[client]; ok {
+			src.AppliedGeneration = gen
+			src.AppliedManifest = manifests[client]
+			src.Error = ""
+		}
+	}
+}
+
+// saveAppliedLocked stores the sources after an apply updated their applied
+// or failed generations.
+func (m *Manager) saveAppliedLocked() {
+	if err := m.saveSourcesLocked(); err != nil {
+		log.Printf("⚠️  Could not save the applied generations: %v", err)
+	}
+}
+
+func (m *Manager) notifyLocked() {
+	close(m.applied)
+	m.applied = make(chan struct{})
+}
+
+// config is one rendered Traefik configuration.
+type config struct {
+	static  string
+	dynamic string
+	// routes maps each route's host and path to its backend, for diffs.
+	routes map[string]string
+	// pending holds the routes waiting for approval, by host:port.
+	pending map[string]PendingRoute
+	// rejected holds the routes left out as invalid or conflicting.
+	rejected rejections
+	exposed  []ExposedRoute
+}
+
+// render builds the Traefik config for the route set. Routes waiting for an
+// operator's approval are left out and collected in cfg.pending; invalid or
+// conflicting routes are left out and collected in cfg.rejected, so they
+// cannot make Traefik reject the whole config.
+func (m *Manager) render(ingresses []renderer.Ingress) (config, error) {
+	pending := make(map[string]PendingRoute)
+	dedicated := make(map[string]bool)
+	var rejected rejections
+	filtered := renderer.Filter(m.claimRoutes(ingresses, &rejected), func(ing renderer.Ingress) (renderer.Ingress, bool) {
+		if err := checkRoute(ing); err != nil {
+			rejected.add(ing, err)
+			return ing, false
+		}
+		out, mode := m.decide(ing)
+		switch mode {
+		case policy.Pending:
+			addPending(pending, ing)
+			return out, false
+		case policy.Private:
+			if m.privateAddr == "" {
+				rejected.add(ing, errors.New("private, but no private address is configured"))
+				return out, false
+			}
+		case policy.Public:
+		default:
+			return out, false
+		}
+		tls, err := m.tlsMode(out)
+		if err != nil {
+			rejected.add(ing, err)
+			return out, false
+		}
+		out.TLS = tls
+		if out.HealthCheck, err = m.healthCheck(out); err != nil {
+			rejected.add(ing, err)
+			return out, false
+		}
+		if out, err = m.withAccess(out); err != nil {
+			rejected.add(ing, err)
+			return out, false
+		}
+		if out.ListenPort == 0 {
+			port, err := m.listenPort(out, dedicated)
+			if err != nil {
+				rejected.add(ing, err)
+				return out, false
+			}
+			out.ListenPort = port
+		}
+		if err := m.checkListenPort(out.ListenPort); err != nil {
+			rejected.add(ing, err)
+			return out, false
+		}
+		if out, err = m.withCertificate(out); err != nil {
+			rejected.add(ing, err)
+			return out, false
+		}
+		return out, true
+	})
+	m.ports.retain(dedicated)
+
+	opts := renderer.StaticOptions{
+		DynamicDir:     m.dynamicDir(),
+		PingAddress:    fmt.Sprintf("127.0.0.1:%d", m.pingPort),
+		PublicAddress:  m.publicAddr,
+		PrivateAddress: m.privateAddr,
+		LogLevel:       m.logLevel,
+		ACME:           m.acme,
+		Dashboard:      m.dashboard,
+	}
+	filtered = m.checkEntryPoints(filtered, opts, &rejected)
+	if m.ca != nil {
+		certified := make(map[string]bool)
+		for _, ing := range filtered {
+			if ing.TLS == renderer.TLSInternal {
+				certified[ing.Host] = true
+			}
+		}
+		m.ca.Retain(certified)
+	}
+
+	model := renderer.BuildDynamic(filtered)
+	if m.dashboard != nil {
+		model.AddDashboard(m.dashboard)
+	}
+	data, err := model.Encode(m.format)
+	if err != nil {
+		return config{}, err
+	}
+	static, err := renderer.RenderStaticTOML(filtered, opts)
+	if err != nil {
+		return config{}, err
+	}
+	cfg := config{
+		static:   static,
+		dynamic:  string(data),
+		routes:   make(map[string]string),
+		pending:  pending,
+		rejected: rejected,
+	}
+	for _, ing := range filtered {
+		key := ing.Host + ing.Path
+		if ing.Path == "" {
+			key += "/"
+		}
+		cfg.routes[key] = fmt.Sprintf("%s:%d %v %s :%d %s", ing.ServiceName, ing.ServicePort, ing.Endpoints, ing.Exposure, ing.ListenPort, ing.TLS)
+		cfg.exposed = append(cfg.exposed, ExposedRoute{
+			Host:        ing.Host,
+			Path:        ing.Path,
+			Port:        ing.ListenPort,
+			BackendPort: ing.ServicePort,
+			Exposure:    ing.Exposure,
+			TLS:         ing.TLS,
+			EntryPoint:  renderer.EntryPointName(ing),
+			Address:     renderer.EntryPointAddress(ing, opts),
+			Namespace:   ing.Namespace,
+			ServiceName: ing.ServiceName,
+			Source:      ing.Source,
+			AllowFrom:   ing.AllowFrom,
+			DenyFrom:    ing.DenyFrom,
+		})
+	}
+	return cfg, nil
+}
+
+// decide applies the operator's decision for a route, or else the exposure
+// policy. With interactive exposure, high-port routes neither covers wait for
+// approval, and promptPending asks about them.
+func (m *Manager) decide(ing renderer.Ingress) (renderer.Ingress, policy.Mode) {
+	if r, ok := m.decisions.Lookup(ing.Host, ing.ServicePort); ok {
+		return expose(ing, r.Mode, r.ExposePort)
+	}
+
+	d := m.policy.Policy().Decide(ing)
+	if !d.Matched && m.interactive && ing.ServicePort > 443 {
+		return ing, policy.Pending
+	}
+	return expose(ing, d.Mode, d.Port)
+}
+
+// promptPending asks on stdin about routes waiting for approval, one at a
+// time and off the render path. An answer resolves the route like `pending
+// approve|deny`; without one the route stays pending and nothing is stored.
+func (m *Manager) promptPending() {
+	for key := range m.prompts {
+		m.mu.Lock()
+		p, ok := m.pending[key]
+		m.mu.Unlock()
+		if !ok {
+			continue
+		}
+		out, ok := renderer.PromptExposure(renderer.Ingress{Host: p.Host, ServiceName: p.ServiceName, ServicePort: p.Port})
+		if !ok {
+			log.Printf("⏳ No answer for %s, it stays pending", key)
+			continue
+		}
+		// An operator may have decided while the prompt was open.
+		if r, decided := m.decisions.Lookup(p.Host, p.Port); decided {
+			log.Printf("⚠️  Answer for %s not applied: %s already set it to %s", key, r.DecidedBy, r.Mode)
+			continue
+		}
+		r := policy.Record{Mode: policy.Mode(out.Exposure), DecidedBy: "prompt"}
+		if err := m.Resolve(key, r); err != nil {
+			log.Printf("⚠️  Answer for %s not applied: %v", key, err)
+		}
+	}
+}
+
+// expose sets the route's exposure and, when the operator picked one, its
+// listen port. The backend port is left alone.
+func expose(ing renderer.Ingress, mode policy.Mode, port int) (renderer.Ingress, policy.Mode) {
+	if mode != policy.Public && mode != policy.Private {
+		return ing, mode
+	}
+	if port != 0 {
+		ing.ListenPort = port
+	}
+	ing.Exposure = string(mode)
+	return ing, mode
+}
+
+// install switches Traefik to cfg and checks that Traefik took it. A config
+// Traefik rejects is rolled back to the last known good one and reported as
+// an error. A config whose hash matches the files on disk is neither written
+// nor reloaded, and install reports it as unchanged. The caller holds applyMu.
+func (m *Manager) install(cfg config) (bool, error) {
+	hash := configHash(cfg.static, cfg.dynamic)
+	if hash == m.diskHash() {
+		log.Printf("⏭️  Config %s unchanged, nothing to write or reload", shortHash(hash))
+		m.supervisor.Start()
+		m.mu.Lock()
+		m.static, m.rendered, m.hash = cfg.static, cfg.dynamic, hash
+		m.exposed = cfg.exposed
+		m.lastApply = time.Now()
+		m.lastError = ""
+		m.mu.Unlock()
+		return false, nil
+	}
+
+	switched := time.Now()
+	if err := m.switchConfig(cfg.static, cfg.dynamic); err != nil {
+		return false, err
+	}
+	if err := m.verify(switched); err != nil {
+		m.rollback()
+		return false, fmt.Errorf("config rejected by traefik, rolled back: %w", err)
+	}
+
+	m.mu.Lock()
+	m.lkgStatic, m.lkgDynamic = cfg.static, cfg.dynamic
+	m.rendered = cfg.dynamic
+	m.hash = hash
+	m.exposed = cfg.exposed
+	m.lastApply = time.Now()
+	m.lastError = ""
+	m.mu.Unlock()
+	if err := m.saveLastKnownGood(cfg.static, cfg.dynamic); err != nil {
+		log.Printf("⚠️  Could not save last known good config: %v", err)
+	}
+	log.Printf("🔖 Config %s applied", shortHash(hash))
+	return true, nil
+}
+
+// configHash identifies a rendered config; it is reported in acks and status.
+func configHash(static, dynamic string) string {
+	h := sha256.New()
+	io.WriteString(h, static)
+	h.Write([]byte{0})
+	io.WriteString(h, dynamic)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func shortHash(hash string) string {
+	if len(hash) > len("sha256:")+12 {
+		return hash[:len("sha256:")+12]
+	}
+	return hash
+}
+
+// diskHash hashes the config files Traefik currently reads, or returns ""
+// when either is missing.
+func (m *Manager) diskHash() string {
+	static, err := os.ReadFile(m.StaticConfigPath())
+	if err != nil {
+		return ""
+	}
+	dynamic, err := os.ReadFile(m.dynamicConfigPath())
+	if err != nil {
+		return ""
+	}
+	return configHash(string(static), string(dynamic))
+}
+
+// switchConfig atomically replaces the config files. The dynamic part is
+// picked up by Traefik's file provider; Traefik is only restarted when the
+// static part (the entrypoints) changes.
+func (m *Manager) switchConfig(static, dynamic string) error {
+	if err := os.MkdirAll(m.dynamicDir(), 0755); err != nil {
+		return fmt.Errorf("mkdir error: %w", err)
+	}
+
+	m.mu.Lock()
+	staticChanged := static != m.static
+	m.mu.Unlock()
+	if staticChanged {
+		if err := fsutil.WriteFileAtomic(m.StaticConfigPath(), []byte(static), 0644); err != nil {
+			return fmt.Errorf("file write error: %w", err)
+		}
+		log.Printf("✅ Static config written to %s", m.StaticConfigPath())
+	}
+
+	if err := fsutil.WriteFileAtomic(m.dynamicConfigPath(), []byte(dynamic), 0644); err != nil {
+		return fmt.Errorf("file write error: %w", err)
+	}
+	log.Printf("✅ Dynamic config written to %s", m.dynamicConfigPath())
+	m.removeStaleDynamic()
+
+	if staticChanged {
+		m.mu.Lock()
+		m.static = static
+		m.mu.Unlock()
+		m.supervisor.Restart()
+	} else {
+		m.supervisor.Start()
+	}
+	return nil
+}
+
+// verify waits for Traefik to settle on the config switched at since, then
+// checks that it answers pings and logged no config errors.
+func (m *Manager) verify(since time.Time) error {
+	time.Sleep(m.reloadSettle)
+	if err := traefik.WaitHealthy(m.pingURL(), m.healthTimeout); err != nil {
+		return err
+	}
+	if errs := m.supervisor.ConfigErrorsSince(since); len(errs) > 0 {
+		return fmt.Errorf("traefik reported: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// rollback restores the last known good config. Without one, the routes are
+// cleared and the current static config is kept.
+func (m *Manager) rollback() {
+	m.mu.Lock()
+	static, dynamic := m.lkgStatic, m.lkgDynamic
+	if static == "" {
+		static = m.static
+	}
+	m.mu.Unlock()
+
+	if err := m.switchConfig(static, dynamic); err != nil {
+		log.Printf("❌ Rollback failed: %v", err)
+		return
+	}
+	log.Println("↩️  Rolled back to the last known good config")
+}
+
+func (m *Manager) saveLastKnownGood(static, dynamic string) error {
+	if err := os.MkdirAll(m.lkgDir(), 0755); err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(m.lkgDir(), "traefik.toml"), []byte(static), 0644); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(filepath.Join(m.lkgDir(), m.dynamicFileName()), []byte(dynamic), 0644)
+}
+
+func (m *Manager) clientsLocked() []string {
+	clients := make([]string, 0, len(m.sources))
+	for client := range m.sources {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	return clients
+}
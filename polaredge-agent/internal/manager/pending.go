@@ -0,0 +1,131 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"polaredge-agent/internal/policy"
+	"polaredge-agent/internal/renderer"
+)
+
+// ErrNotPending is returned when approving or denying a route that is not
+// waiting for a decision.
+var ErrNotPending = errors.New("no pending route")
+
+// PendingRoute is a route held back until an operator approves or denies it.
+type PendingRoute struct {
+	Host        string    `json:"host"`
+	Port        int       `json:"port"`
+	Namespace   string    `json:"namespace,omitempty"`
+	ServiceName string    `json:"serviceName"`
+	Paths       []string  `json:"paths,omitempty"`
+	Sources     []string  `json:"sources"`
+	Since       time.Time `json:"since"`
+}
+
+// Key identifies the route as approvals address it, "host:port".
+func (p PendingRoute) Key() string {
+	return p.Host + ":" + strconv.Itoa(p.Port)
+}
+
+func addPending(pending map[string]PendingRoute, ing renderer.Ingress) {
+	p := PendingRoute{Host: ing.Host, Port: ing.ServicePort, Namespace: ing.Namespace, ServiceName: ing.ServiceName}
+	if existing, ok := pending[p.Key()]; ok {
+		p = existing
+	}
+	if ing.Path != "" {
+		p.Paths = appendUnique(p.Paths, ing.Path)
+	}
+	p.Sources = appendUnique(p.Sources, ing.Source)
+	pending[p.Key()] = p
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// updatePending replaces the pending set after a render, keeping the time
+// each route has been waiting since. With interactive exposure, new routes
+// are queued for promptPending; when the queue is full they wait for the
+// pending command instead.
+func (m *Manager) updatePending(next map[string]PendingRoute) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var added []string
+	for key, p := range next {
+		if prev, ok := m.pending[key]; ok {
+			p.Since = prev.Since
+		} else {
+			p.Since = now
+			added = append(added, key)
+			log.Printf("⏸️  Route %s (%s) is waiting for approval: polaredge-agent pending approve|deny %s", key, p.ServiceName, key)
+		}
+		next[key] = p
+	}
+	m.pending = next
+
+	if !m.interactive {
+		return
+	}
+	sort.Strings(added)
+	for _, key := range added {
+		select {
+		case m.prompts <- key:
+		default:
+		}
+	}
+}
+
+func (m *Manager) pendingLocked() []PendingRoute {
+	out := make([]PendingRoute, 0, len(m.pending))
+	for _, p := range m.pending {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key() < out[j].Key() })
+	return out
+}
+
+// pendingForLocked lists the pending routes that came from client.
+func (m *Manager) pendingForLocked(client string) []string {
+	var keys []string
+	for _, p := range m.pendingLocked() {
+		for _, src := range p.Sources {
+			if src == client {
+				keys = append(keys, p.Key())
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// Pending returns the routes waiting for approval.
+func (m *Manager) Pending() []PendingRoute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pendingLocked()
+}
+
+// Resolve records an operator's answer for a pending route as an exposure
+// decision, which re-renders the config. Approving sets mode public or
+// private; denying sets off.
+func (m *Manager) Resolve(key string, r policy.Record) error {
+	m.mu.Lock()
+	p, ok := m.pending[key]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNotPending, key)
+	}
+	r.Host, r.Port = p.Host, p.Port
+	return m.SetDecision(r)
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"polaredge-agent/internal/fsutil"
+	"polaredge-agent/internal/renderer"
+)
+
+// EntryPointAnnotation picks the entrypoint an Ingress is served on: "web"
+// (port 80, the default for plain HTTP), "websecure" (443, the default for
+// TLS routes) or "dedicated" for a host port of its own from the agent's
+// port range.
+const EntryPointAnnotation = "polaredge.io/entrypoint"
+
+// listenPort resolves the listen port a route asked for. Dedicated ports are
+// recorded in used so that allocations of vanished routes can be released.
+func (m *Manager) listenPort(ing renderer.Ingress, used map[string]bool) (int, error) {
+	switch v := ing.Annotations[EntryPointAnnotation]; v {
+	case "":
+		if ing.TLS != "" {
+			return renderer.WebSecurePort, nil
+		}
+		return renderer.WebPort, nil
+	case "web":
+		if ing.TLS != "" {
+			return 0, fmt.Errorf("%s web cannot serve TLS, use websecure or dedicated", EntryPointAnnotation)
+		}
+		return renderer.WebPort, nil
+	case "websecure":
+		return renderer.WebSecurePort, nil
+	case "dedicated":
+		key := ing.Host + ":" + strconv.Itoa(ing.ServicePort)
+		used[key] = true
+		return m.ports.allocate(key)
+	default:
+		return 0, fmt.Errorf("unknown %s %q", EntryPointAnnotation, v)
+	}
+}
+
+// portAllocator hands out dedicated listen ports and remembers them in path,
+// so a route keeps its port across renders and restarts.
+type portAllocator struct {
+	path     string
+	min, max int
+	// ports maps host:servicePort to the allocated listen port.
+	ports map[string]int
+}
+
+func openPorts(path string, min, max int) (*portAllocator, error) {
+	a := &portAllocator{path: path, min: min, max: max, ports: make(map[string]int)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &a.ports); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// allocate returns the port held by key, or the first free one in range.
+func (a *portAllocator) allocate(key string) (int, error) {
+	if port, ok := a.ports[key]; ok && port >= a.min && port <= a.max {
+		return port, nil
+	}
+	taken := make(map[int]bool, len(a.ports))
+	for _, port := range a.ports {
+		taken[port] = true
+	}
+	for port := a.min; port <= a.max; port++ {
+		if taken[port] || renderer.IsPortInUse(port) {
+			continue
+		}
+		a.ports[key] = port
+		log.Printf("🔌 Allocated listen port %d to %s", port, key)
+		return port, a.save()
+	}
+	return 0, fmt.Errorf("no free listen port in range %d-%d", a.min, a.max)
+}
+
+// retain releases the ports of routes not in used.
+func (a *portAllocator) retain(used map[string]bool) {
+	changed := false
+	for key, port := range a.ports {
+		if !used[key] {
+			log.Printf("🔌 Released listen port %d of %s", port, key)
+			delete(a.ports, key)
+			changed = true
+		}
+	}
+	if changed {
+		if err := a.save(); err != nil {
+			log.Printf("⚠️  Could not save listen ports: %v", err)
+		}
+	}
+}
+
+func (a *portAllocator) save() error {
+	data, err := json.MarshalIndent(a.ports, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(a.path, data, 0600)
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"polaredge-agent/internal/history"
+	"polaredge-agent/internal/renderer"
+)
+
+// History returns the store of applied configs.
+func (m *Manager) History() *history.Store {
+	return m.history
+}
+
+// Rollback switches Traefik back to a recorded revision and pins it: manifests
+// already queued are not rendered until the next manifest arrives or Unpin is
+// called. Each source's applied generation and manifest become the
+// revision's.
+func (m *Manager) Rollback(revision int64) (history.Entry, error) {
+	rev, err := m.history.Get(revision)
+	if err != nil {
+		return history.Entry{}, err
+	}
+
+	if format := rev.DynamicFormat; format != m.format && !(format == "" && m.format == renderer.FormatTOML) {
+		return history.Entry{}, fmt.Errorf("revision %d was rendered as %s, the agent now writes %s", revision, format, m.format)
+	}
+
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	cfg := config{static: rev.StaticConfig, dynamic: rev.DynamicConfig, routes: rev.Routes}
+	if len(rev.Exposed) > 0 {
+		if err := json.Unmarshal(rev.Exposed, &cfg.exposed); err != nil {
+			log.Printf("⚠️  Revision %d has unreadable route details: %v", revision, err)
+		}
+	}
+	if _, err := m.install(cfg); err != nil {
+		return history.Entry{}, fmt.Errorf("revision %d: %w", revision, err)
+	}
+	if err := m.history.Pin(revision); err != nil {
+		return history.Entry{}, fmt.Errorf("pin revision %d: %w", revision, err)
+	}
+	// Sources now run the generations of the revision, so diffs and acks
+	// report those until the pin is lifted. The rejected routes were those of
+	// the newer render.
+	m.mu.Lock()
+	for client, src := range m.sources {
+		src.AppliedGeneration = rev.Generations[client]
+		src.AppliedManifest = rev.Manifests[client]
+	}
+	m.saveAppliedLocked()
+	m.rejected = nil
+	m.mu.Unlock()
+	log.Printf("📌 Rolled back to revision %d, pinned until the next manifest or unpin", revision)
+
+	entry := m.recordHistory(history.Revision{
+		Entry: history.Entry{
+			Client:      "rollback",
+			Generations: rev.Generations,
+			Summary:     fmt.Sprintf("rollback to revision %d", revision),
+		},
+		Manifests: rev.Manifests,
+	}, cfg)
+	return entry, nil
+}
+
+// Unpin lifts a rollback pin and renders the current manifests again.
+func (m *Manager) Unpin() error {
+	if m.history.Pinned() == 0 {
+		return nil
+	}
+	if err := m.history.Unpin(); err != nil {
+		return err
+	}
+	log.Println("📌 Rollback pin lifted, rendering the current manifests")
+	m.trigger()
+	return nil
+}
+
+// unpin lifts a rollback pin because a new manifest or intent arrived.
+func (m *Manager) unpin(reason string) {
+	rev := m.history.Pinned()
+	if rev == 0 {
+		return
+	}
+	if err := m.history.Unpin(); err != nil {
+		log.Printf("⚠️  Could not lift the pin on revision %d: %v", rev, err)
+		return
+	}
+	log.Printf("📌 Pin on revision %d lifted by %s", rev, reason)
+}
+
+// recordHistory stores cfg as a new revision with a summary of the route
+// changes since the previous one, appended to any summary rev already has.
+// The caller holds applyMu.
+func (m *Manager) recordHistory(rev history.Revision, cfg config) history.Entry {
+	m.mu.Lock()
+	before := m.routes
+	m.routes = cfg.routes
+	m.mu.Unlock()
+
+	summary := history.Summarize(before, cfg.routes)
+	if rev.Summary != "" {
+		summary = rev.Summary + ": " + summary
+	}
+	rev.Summary = summary
+	rev.StaticConfig = cfg.static
+	rev.DynamicConfig = cfg.dynamic
+	rev.DynamicFormat = m.format
+	rev.Routes = cfg.routes
+	rev.Exposed, _ = json.Marshal(cfg.exposed)
+	entry, err := m.history.Record(rev)
+	if err != nil {
+		log.Printf("⚠️  Could not record config history: %v", err)
+		return rev.Entry
+	}
+	log.Printf("🗂️  Recorded revision %d (%s)", entry.Revision, entry.Summary)
+	return entry
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"polaredge-agent/internal/history"
+	"polaredge-agent/internal/renderer"
+)
+
+func TestPinHoldsUntilNewManifest(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir)
+	routes := []renderer.Ingress{{Host: "shop.example.com", ServiceName: "web", ServicePort: 80}}
+	submit(t, m, "c1", 1, routes)
+	if _, err := m.History().Record(history.Revision{Entry: history.Entry{Client: "c1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.History().Pin(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// While pinned, queued manifests are not rendered.
+	m.apply()
+	if _, err := os.Stat(m.StaticConfigPath()); !os.IsNotExist(err) {
+		t.Fatalf("apply wrote a config while pinned (%v)", err)
+	}
+
+	// A resend carries nothing new and keeps the pin, even across a restart.
+	submit(t, m, "c1", 1, routes)
+	restarted := newTestManager(t, dir)
+	if restarted.History().Pinned() != 1 {
+		t.Fatalf("pin after a resend and a restart = %d, want 1", restarted.History().Pinned())
+	}
+
+	// A new generation lifts it.
+	submit(t, restarted, "c1", 2, routes)
+	if rev := restarted.History().Pinned(); rev != 0 {
+		t.Fatalf("pin after a new generation = %d, want none", rev)
+	}
+}
+
+func TestRollbackRefusesUnusableRevisions(t *testing.T) {
+	m := newTestManager(t, t.TempDir())
+	if _, err := m.Rollback(7); !errors.Is(err, history.ErrNotFound) {
+		t.Fatalf("Rollback of an unknown revision = %v, want ErrNotFound", err)
+	}
+
+	// The dynamic config of a revision is installed as is, so it must be in
+	// the format the agent writes now.
+	if _, err := m.History().Record(history.Revision{DynamicFormat: renderer.FormatYAML}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Rollback(1); err == nil {
+		t.Fatal("Rollback to a yaml revision succeeded on a toml agent")
+	}
+	if m.History().Pinned() != 0 {
+		t.Fatal("a refused rollback left a pin")
+	}
+}
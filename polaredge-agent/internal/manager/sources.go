@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"polaredge-agent/internal/fsutil"
+)
+
+// sourcesPath keeps every client's latest manifest across restarts, so the
+// first render after a restart still has the routes of clients that have
+// nothing new to send.
+func (m *Manager) sourcesPath() string {
+	return filepath.Join(m.stateDir, "sources.json")
+}
+
+func (m *Manager) loadSources() error {
+	data, err := os.ReadFile(m.sourcesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read sources: %w", err)
+	}
+
+	var sources []Source
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return fmt.Errorf("parse %s: %w", m.sourcesPath(), err)
+	}
+	for i := range sources {
+		src := &sources[i]
+		if err := json.Unmarshal(src.Manifest, &src.ingresses); err != nil {
+			return fmt.Errorf("parse %s: manifest of %q: %w", m.sourcesPath(), src.Client, err)
+		}
+		m.sources[src.Client] = src
+	}
+	return nil
+}
+
+func (m *Manager) saveSourcesLocked() error {
+	if err := os.MkdirAll(m.stateDir, 0755); err != nil {
+		return err
+	}
+	sources := make([]Source, 0, len(m.sources))
+	for _, client := range m.clientsLocked() {
+		sources = append(sources, *m.sources[client])
+	}
+	data, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(m.sourcesPath(), data, 0644)
+}
@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"polaredge-agent/internal/protocol"
+	"polaredge-agent/internal/renderer"
+)
+
+func newTestManager(t *testing.T, stateDir string) *Manager {
+	t.Helper()
+	m, err := New(Options{
+		TraefikDir: filepath.Join(stateDir, "traefik"),
+		StateDir:   stateDir,
+		AckTimeout: 10 * time.Millisecond,
+		PingPort:   8082,
+		PortMin:    47000,
+		PortMax:    47100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func submit(t *testing.T, m *Manager, client string, generation int64, routes []renderer.Ingress) {
+	t.Helper()
+	manifest, err := json.Marshal(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack := m.Submit(&protocol.Envelope{Client: client, Generation: generation, Manifest: manifest})
+	if ack.Status != protocol.AckQueued {
+		t.Fatalf("ack of %s generation %d = %+v, want queued", client, generation, ack)
+	}
+}
+
+// renderSources renders the routes of every source the way apply does.
+func renderSources(t *testing.T, m *Manager) config {
+	t.Helper()
+	var ingresses []renderer.Ingress
+	for _, client := range m.clientsLocked() {
+		for _, ing := range m.sources[client].ingresses {
+			ing.Source = client
+			ingresses = append(ingresses, ing)
+		}
+	}
+	cfg, err := m.render(ingresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestSourcesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir)
+	submit(t, m, "c1", 3, []renderer.Ingress{
+		{Namespace: "shop", Host: "shop.example.com", ServiceName: "web", ServicePort: 80},
+		{Namespace: "shop", Host: "game.example.com", ServiceName: "game", ServicePort: 443,
+			Annotations: map[string]string{EntryPointAnnotation: "dedicated"}},
+	})
+	submit(t, m, "c2", 7, []renderer.Ingress{
+		{Namespace: "blog", Host: "blog.example.com", ServiceName: "web", ServicePort: 80},
+	})
+	before := renderSources(t, m)
+
+	// The restarted agent renders on its first trigger, before any client
+	// resends; no route may go missing or lose its port.
+	restarted := newTestManager(t, dir)
+	for client, generation := range map[string]int64{"c1": 3, "c2": 7} {
+		src, ok := restarted.Source(client)
+		if !ok || src.Generation != generation {
+			t.Fatalf("source %s after restart = %+v, %t, want generation %d", client, src, ok, generation)
+		}
+	}
+	after := renderSources(t, restarted)
+	if after.static != before.static || after.dynamic != before.dynamic {
+		t.Fatalf("config after restart differs:\n%s\n%s\nwant\n%s\n%s", after.static, after.dynamic, before.static, before.dynamic)
+	}
+	if len(after.exposed) != 3 {
+		t.Fatalf("exposed %d routes after restart, want 3", len(after.exposed))
+	}
+	if port := restarted.ports.ports["game.example.com:443"]; port == 0 {
+		t.Fatal("the dedicated port was released after restart")
+	}
+}
+
+func TestSourcesKeepAppliedGeneration(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir)
+	submit(t, m, "c1", 1, []renderer.Ingress{{Host: "shop.example.com", ServiceName: "web", ServicePort: 80}})
+
+	m.mu.Lock()
+	m.sources["c1"].AppliedGeneration = 1
+	m.saveAppliedLocked()
+	m.mu.Unlock()
+
+	// A resend of the applied generation is acked as applied, not rendered
+	// again as if it were new.
+	restarted := newTestManager(t, dir)
+	ack := restarted.waitApplied("c1", 1)
+	if ack.Status != protocol.AckApplied {
+		t.Fatalf("ack after restart = %+v, want applied", ack)
+	}
+}
@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"polaredge-agent/internal/renderer"
+)
+
+// TLSAnnotation picks how a route's certificate is obtained: "acme",
+// "internal" or "none". Without it, public routes use ACME and private
+// routes the internal CA when the agent is configured to do so by default.
+const TLSAnnotation = "polaredge.io/tls"
+
+// caRotationCheck bounds how long a due leaf rotation can go unnoticed;
+// caRotationRetry spaces out retries while a rotation does not go through.
+const (
+	caRotationCheck = time.Hour
+	caRotationRetry = time.Minute
+)
+
+var (
+	errNoACME = errors.New("tls: acme requested but the agent has no acme resolver configured")
+	errNoCA   = errors.New("tls: internal requested but the agent has no internal CA configured")
+)
+
+// tlsMode decides whether a route is served over TLS, and with which
+// certificate.
+func (m *Manager) tlsMode(ing renderer.Ingress) (string, error) {
+	mode := ing.Annotations[TLSAnnotation]
+	switch mode {
+	case "":
+		switch {
+		case ing.Exposure == "public" && m.acme != nil && m.acmeDefault:
+			return renderer.TLSACME, nil
+		case ing.Exposure == "private" && m.ca != nil && m.caDefault:
+			return renderer.TLSInternal, nil
+		}
+		return "", nil
+	case "none":
+		return "", nil
+	case renderer.TLSACME:
+		if m.acme == nil {
+			return "", errNoACME
+		}
+		if ing.Exposure != "public" {
+			return "", fmt.Errorf("tls: acme needs a public route, the ACME CA cannot reach %s routes", ing.Exposure)
+		}
+		return renderer.TLSACME, nil
+	case renderer.TLSInternal:
+		if m.ca == nil {
+			return "", errNoCA
+		}
+		return renderer.TLSInternal, nil
+	default:
+		return "", fmt.Errorf("unknown %s %q", TLSAnnotation, mode)
+	}
+}
+
+// withCertificate attaches the internal CA's current certificate for the
+// route's host, issuing or rotating it as needed.
+func (m *Manager) withCertificate(ing renderer.Ingress) (renderer.Ingress, error) {
+	if ing.TLS != renderer.TLSInternal {
+		return ing, nil
+	}
+	leaf, err := m.ca.Leaf(ing.Host)
+	if err != nil {
+		return ing, err
+	}
+	ing.CertFile, ing.KeyFile = leaf.CertFile, leaf.KeyFile
+	return ing, nil
+}
+
+// CABundle returns the internal CA certificate in PEM, or nil without one.
+func (m *Manager) CABundle() []byte {
+	if m.ca == nil {
+		return nil
+	}
+	return m.ca.Bundle()
+}
+
+// rotateCertificates re-renders when a leaf of the internal CA is due, so the
+// rotated certificate reaches Traefik.
+func (m *Manager) rotateCertificates() {
+	for {
+		wait := caRotationCheck
+		if next := m.ca.NextRotation(); !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		if wait < caRotationRetry {
+			wait = caRotationRetry
+		}
+		time.Sleep(wait)
+		if next := m.ca.NextRotation(); !next.IsZero() && !time.Now().Before(next) {
+			log.Println("🔏 Internal certificates due for rotation, re-rendering")
+			m.trigger()
+		}
+	}
+}
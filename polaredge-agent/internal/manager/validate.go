@@ -0,0 +1,249 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"polaredge-agent/internal/policy"
+	"polaredge-agent/internal/renderer"
+)
+
+// RejectedRoute is a route left out of the config because it is invalid or
+// conflicts with another route. The rest of the route set is still applied.
+type RejectedRoute struct {
+	Host        string `json:"host"`
+	Path        string `json:"path,omitempty"`
+	Port        int    `json:"port"`
+	Namespace   string `json:"namespace,omitempty"`
+	ServiceName string `json:"serviceName"`
+	Source      string `json:"source"`
+	Reason      string `json:"reason"`
+}
+
+// String is the route and why it was rejected, as acks report it.
+func (r RejectedRoute) String() string {
+	return fmt.Sprintf("%s%s:%d: %s", r.Host, r.Path, r.Port, r.Reason)
+}
+
+// rejections collects the routes a render leaves out.
+type rejections []RejectedRoute
+
+func (r *rejections) add(ing renderer.Ingress, err error) {
+	log.Printf("❌ %s%s from %s: %v, leaving it off", ing.Host, ing.Path, ing.Source, err)
+	*r = append(*r, RejectedRoute{
+		Host:        ing.Host,
+		Path:        ing.Path,
+		Port:        ing.ServicePort,
+		Namespace:   ing.Namespace,
+		ServiceName: ing.ServiceName,
+		Source:      ing.Source,
+		Reason:      err.Error(),
+	})
+}
+
+// checkRoute validates what a route brings with it from its source, before
+// anything is decided or issued for it.
+func checkRoute(ing renderer.Ingress) error {
+	if err := checkHost(ing.Host); err != nil {
+		return err
+	}
+	if ing.Path != "" && (!strings.HasPrefix(ing.Path, "/") || strings.ContainsAny(ing.Path, "`\"\\ \t\r\n")) {
+		return fmt.Errorf("path %q is not a valid URL path", ing.Path)
+	}
+	if ing.ServicePort < 1 || ing.ServicePort > 65535 {
+		return fmt.Errorf("service port %d is out of range", ing.ServicePort)
+	}
+	if ing.ServiceName == "" && len(ing.Endpoints) == 0 {
+		return fmt.Errorf("no backend: neither a service nor endpoints")
+	}
+	if ing.ServiceName != "" && checkHost(ing.ServiceName) != nil {
+		return fmt.Errorf("service name %q is not a valid hostname", ing.ServiceName)
+	}
+	for _, ep := range ing.Endpoints {
+		host, port, err := net.SplitHostPort(ep)
+		if err != nil || net.ParseIP(host) == nil {
+			return fmt.Errorf("endpoint %q is not ip:port", ep)
+		}
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("endpoint %q has an invalid port", ep)
+		}
+	}
+	return nil
+}
+
+// checkHost accepts DNS names the Host rule can match. Wildcards would need
+// HostRegexp, which the agent does not render.
+func checkHost(host string) error {
+	switch {
+	case host == "":
+		return fmt.Errorf("no host")
+	case strings.HasPrefix(host, "*."):
+		return fmt.Errorf("wildcard host %q is not supported", host)
+	case len(host) > 253:
+		return fmt.Errorf("host %q is too long", host)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("host %q is not a valid DNS name", host)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("host %q is not a valid DNS name", host)
+			}
+		}
+	}
+	return nil
+}
+
+// checkListenPort refuses listen ports out of range, outside the ports the
+// operator allows, or taken by the agent and the host, e.g. ssh and the
+// manifest socket.
+func (m *Manager) checkListenPort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("listen port %d is out of range", port)
+	}
+	if len(m.listenPorts) > 0 && !policy.InPortRanges(m.listenPorts, port) {
+		allowed := make([]string, len(m.listenPorts))
+		for i, r := range m.listenPorts {
+			allowed[i] = r.String()
+		}
+		return fmt.Errorf("listen port %d is not allowed (listenPorts %s)", port, strings.Join(allowed, ", "))
+	}
+	if m.reservedPorts[port] {
+		return fmt.Errorf("listen port %d is reserved", port)
+	}
+	return nil
+}
+
+// claimRoutes keeps each host and path with a single source. When several
+// sources claim one, the source serving it in the applied config keeps it,
+// else the first source by name; the other claims are rejected.
+func (m *Manager) claimRoutes(ingresses []renderer.Ingress, rejected *rejections) []renderer.Ingress {
+	m.mu.Lock()
+	owners := make(map[string]string)
+	for _, r := range m.exposed {
+		owners[routeKey(r.Host, r.Path)] = r.Source
+	}
+	m.mu.Unlock()
+
+	claims := make(map[string][]string)
+	for _, ing := range ingresses {
+		key := routeKey(ing.Host, ing.Path)
+		claims[key] = appendUnique(claims[key], ing.Source)
+	}
+	winners := make(map[string]string)
+	for key, sources := range claims {
+		if len(sources) == 1 {
+			continue
+		}
+		sort.Strings(sources)
+		winners[key] = sources[0]
+		for _, src := range sources {
+			if src == owners[key] {
+				winners[key] = src
+			}
+		}
+	}
+
+	kept := make([]renderer.Ingress, 0, len(ingresses))
+	for _, ing := range ingresses {
+		key := routeKey(ing.Host, ing.Path)
+		if winner, ok := winners[key]; ok && ing.Source != winner {
+			rejected.add(ing, fmt.Errorf("%s is already claimed by %s", key, winner))
+			continue
+		}
+		kept = append(kept, ing)
+	}
+	return kept
+}
+
+// checkEntryPoints rejects routes whose entrypoint would bind a port another
+// entrypoint already binds on an overlapping address, which would keep
+// Traefik from starting. Like claimRoutes, an entrypoint of the applied
+// config keeps its port; otherwise the first in render order does.
+func (m *Manager) checkEntryPoints(ingresses []renderer.Ingress, opts renderer.StaticOptions, rejected *rejections) []renderer.Ingress {
+	m.mu.Lock()
+	applied := make(map[string]bool)
+	for _, r := range m.exposed {
+		applied[r.EntryPoint+"@"+r.Address] = true
+	}
+	m.mu.Unlock()
+	sorted := renderer.SortedIngresses(ingresses)
+	isApplied := func(ing renderer.Ingress) bool {
+		return applied[renderer.EntryPointName(ing)+"@"+renderer.EntryPointAddress(ing, opts)]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return isApplied(sorted[i]) && !isApplied(sorted[j]) })
+
+	type binding struct{ name, host string }
+	bound := make(map[string][]binding)
+	bind := func(name, addr string) {
+		host, port, _ := net.SplitHostPort(addr)
+		bound[port] = append(bound[port], binding{name, host})
+	}
+	if opts.Dashboard != nil {
+		bind(renderer.DashboardEntryPoint, opts.Dashboard.Address)
+	}
+	bind(renderer.PingEntryPoint, opts.PingAddress)
+	if opts.ACME != nil {
+		challenge := renderer.Ingress{ListenPort: renderer.WebPort}
+		if opts.ACME.Challenge == renderer.ChallengeTLSALPN {
+			challenge.ListenPort = renderer.WebSecurePort
+		}
+		bind(renderer.EntryPointName(challenge), renderer.EntryPointAddress(challenge, opts))
+	}
+
+	kept := make([]renderer.Ingress, 0, len(ingresses))
+	for _, ing := range sorted {
+		name, addr := renderer.EntryPointName(ing), renderer.EntryPointAddress(ing, opts)
+		host, port, _ := net.SplitHostPort(addr)
+		collides := ""
+		for _, b := range bound[port] {
+			if b.name != name && (b.host == host || anyHost(b.host) || anyHost(host)) {
+				collides = b.name
+				break
+			}
+		}
+		if collides != "" {
+			rejected.add(ing, fmt.Errorf("entrypoint %s (%s) collides with %s on port %s", name, addr, collides, port))
+			continue
+		}
+		bind(name, addr)
+		kept = append(kept, ing)
+	}
+	return kept
+}
+
+// anyHost reports whether a listen host binds every interface.
+func anyHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
+
+func routeKey(host, path string) string {
+	if path == "" {
+		path = "/"
+	}
+	return host + path
+}
+
+// updateRejected replaces the rejected routes after a render.
+func (m *Manager) updateRejected(next rejections) {
+	sort.SliceStable(next, func(i, j int) bool { return next[i].String() < next[j].String() })
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected = next
+}
+
+// rejectedForLocked lists why the routes of client were rejected.
+func (m *Manager) rejectedForLocked(client string) []string {
+	var out []string
+	for _, r := range m.rejected {
+		if r.Source == client {
+			out = append(out, r.String())
+		}
+	}
+	return out
+}
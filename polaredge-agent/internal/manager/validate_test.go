@@ -0,0 +1,241 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"polaredge-agent/internal/policy"
+	"polaredge-agent/internal/renderer"
+)
+
+func TestCheckRoute(t *testing.T) {
+	valid := renderer.Ingress{Host: "shop.example.com", Path: "/api", ServiceName: "web", ServicePort: 80}
+	with := func(edit func(*renderer.Ingress)) renderer.Ingress {
+		ing := valid
+		edit(&ing)
+		return ing
+	}
+
+	tests := []struct {
+		name string
+		ing  renderer.Ingress
+		err  string
+	}{
+		{"valid", valid, ""},
+		{"trailing dot", with(func(i *renderer.Ingress) { i.Host = "shop.example.com." }), ""},
+		{"endpoints only", with(func(i *renderer.Ingress) {
+			i.ServiceName, i.Endpoints = "", []string{"10.42.0.11:8080", "[fd00::1]:80"}
+		}), ""},
+		{"no host", with(func(i *renderer.Ingress) { i.Host = "" }), "no host"},
+		{"wildcard host", with(func(i *renderer.Ingress) { i.Host = "*.example.com" }), "wildcard"},
+		{"underscore", with(func(i *renderer.Ingress) { i.Host = "shop_1.example.com" }), "not a valid DNS name"},
+		{"leading hyphen", with(func(i *renderer.Ingress) { i.Host = "-shop.example.com" }), "not a valid DNS name"},
+		{"empty label", with(func(i *renderer.Ingress) { i.Host = "shop..example.com" }), "not a valid DNS name"},
+		{"long label", with(func(i *renderer.Ingress) { i.Host = strings.Repeat("a", 64) + ".example.com" }), "not a valid DNS name"},
+		{"long host", with(func(i *renderer.Ingress) { i.Host = strings.Repeat("a.", 127) + "com" }), "too long"},
+		{"relative path", with(func(i *renderer.Ingress) { i.Path = "api" }), "not a valid URL path"},
+		{"backtick in path", with(func(i *renderer.Ingress) { i.Path = "/api`) || Host(`x" }), "not a valid URL path"},
+		{"port zero", with(func(i *renderer.Ingress) { i.ServicePort = 0 }), "out of range"},
+		{"port too high", with(func(i *renderer.Ingress) { i.ServicePort = 65536 }), "out of range"},
+		{"no backend", with(func(i *renderer.Ingress) { i.ServiceName = "" }), "no backend"},
+		{"bad service name", with(func(i *renderer.Ingress) { i.ServiceName = "web:80" }), "service name"},
+		{"endpoint without port", with(func(i *renderer.Ingress) { i.Endpoints = []string{"10.42.0.11"} }), "not ip:port"},
+		{"endpoint hostname", with(func(i *renderer.Ingress) { i.Endpoints = []string{"web:80"} }), "not ip:port"},
+		{"endpoint port", with(func(i *renderer.Ingress) { i.Endpoints = []string{"10.42.0.11:0"} }), "invalid port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRoute(tt.ing)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("checkRoute = %v, want nil", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("checkRoute = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckEntryPoints(t *testing.T) {
+	base := renderer.StaticOptions{PingAddress: "127.0.0.1:8082", PrivateAddress: "10.88.0.1"}
+	dashboard := base
+	dashboard.Dashboard = &renderer.DashboardOptions{Address: "10.88.0.1:8080"}
+	acme := base
+	acme.ACME = &renderer.ACMEOptions{}
+
+	route := func(host, exposure string, port int) renderer.Ingress {
+		return renderer.Ingress{Source: "c1", Host: host, ServiceName: "web", ServicePort: port, ListenPort: port, Exposure: exposure}
+	}
+
+	tests := []struct {
+		name     string
+		opts     renderer.StaticOptions
+		exposed  []ExposedRoute
+		routes   []renderer.Ingress
+		rejected []string
+	}{
+		{
+			name: "distinct ports",
+			opts: base,
+			routes: []renderer.Ingress{
+				route("a.example.com", "public", 7000),
+				route("b.example.com", "private", 7001),
+			},
+		},
+		{
+			name: "one entrypoint shared by routes",
+			opts: base,
+			routes: []renderer.Ingress{
+				route("a.example.com", "public", 7000),
+				route("b.example.com", "public", 7000),
+			},
+		},
+		{
+			name:     "ping port on all interfaces",
+			opts:     base,
+			routes:   []renderer.Ingress{route("a.example.com", "public", 8082)},
+			rejected: []string{"a.example.com"},
+		},
+		{
+			name:   "ping port on another address",
+			opts:   base,
+			routes: []renderer.Ingress{route("a.example.com", "private", 8082)},
+		},
+		{
+			name:     "dashboard port",
+			opts:     dashboard,
+			routes:   []renderer.Ingress{route("a.example.com", "private", 8080)},
+			rejected: []string{"a.example.com"},
+		},
+		{
+			name:   "acme challenge entrypoint shared",
+			opts:   acme,
+			routes: []renderer.Ingress{route("a.example.com", "public", 80)},
+		},
+		{
+			name:     "acme challenge port",
+			opts:     acme,
+			routes:   []renderer.Ingress{route("a.example.com", "private", 80)},
+			rejected: []string{"a.example.com"},
+		},
+		{
+			name: "first in render order wins",
+			opts: base,
+			routes: []renderer.Ingress{
+				route("b.example.com", "private", 7000),
+				route("a.example.com", "public", 7000),
+			},
+			rejected: []string{"b.example.com"},
+		},
+		{
+			name:    "applied binding wins",
+			opts:    base,
+			exposed: []ExposedRoute{{Host: "b.example.com", EntryPoint: "private-port7000", Address: "10.88.0.1:7000"}},
+			routes: []renderer.Ingress{
+				route("a.example.com", "public", 7000),
+				route("b.example.com", "private", 7000),
+			},
+			rejected: []string{"a.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{exposed: tt.exposed}
+			var rejected rejections
+			kept := m.checkEntryPoints(tt.routes, tt.opts, &rejected)
+
+			var hosts []string
+			for _, r := range rejected {
+				hosts = append(hosts, r.Host)
+			}
+			if strings.Join(hosts, ",") != strings.Join(tt.rejected, ",") {
+				t.Errorf("rejected %v, want %v", rejected, tt.rejected)
+			}
+			if len(kept)+len(rejected) != len(tt.routes) {
+				t.Errorf("kept %d and rejected %d of %d routes", len(kept), len(rejected), len(tt.routes))
+			}
+		})
+	}
+}
+
+func portRanges(t *testing.T, specs ...string) []policy.PortRange {
+	t.Helper()
+	var ranges []policy.PortRange
+	for _, spec := range specs {
+		r, err := policy.ParsePortRange(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+func TestCheckListenPort(t *testing.T) {
+	m := &Manager{
+		reservedPorts: map[int]bool{22: true, 9005: true},
+		listenPorts:   portRanges(t, "80", "443", "1024-65535"),
+	}
+	tests := []struct {
+		port int
+		err  string
+	}{
+		{80, ""},
+		{443, ""},
+		{7000, ""},
+		{0, "out of range"},
+		{70000, "out of range"},
+		{25, "not allowed"},
+		{1023, "not allowed"},
+		{22, "not allowed"},
+		{9005, "reserved"},
+	}
+	for _, tt := range tests {
+		err := m.checkListenPort(tt.port)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("checkListenPort(%d) = %v, want nil", tt.port, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("checkListenPort(%d) = %v, want an error containing %q", tt.port, err, tt.err)
+		}
+	}
+}
+
+func TestRenderRejectsDisallowedListenPort(t *testing.T) {
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "exposure.json")
+	rules := `{"rules": [{"hosts": ["mail.example.com"], "mode": "public", "port": 25}]}`
+	if err := os.WriteFile(policyPath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exposure, err := policy.Load(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(Options{
+		TraefikDir:  filepath.Join(dir, "traefik"),
+		StateDir:    dir,
+		PingPort:    8082,
+		Policy:      exposure,
+		ListenPorts: portRanges(t, "80", "443", "1024-65535"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := m.render([]renderer.Ingress{
+		{Source: "c1", Host: "mail.example.com", ServiceName: "webmail", ServicePort: 80},
+		{Source: "c1", Host: "shop.example.com", ServiceName: "web", ServicePort: 80},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.rejected) != 1 || cfg.rejected[0].Host != "mail.example.com" || !strings.Contains(cfg.rejected[0].Reason, "not allowed") {
+		t.Fatalf("rejected = %v, want mail.example.com for its listen port", cfg.rejected)
+	}
+	if len(cfg.exposed) != 1 || cfg.exposed[0].Host != "shop.example.com" {
+		t.Fatalf("exposed = %v, want only shop.example.com", cfg.exposed)
+	}
+}
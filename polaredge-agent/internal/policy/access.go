@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"polaredge-agent/internal/renderer"
+)
+
+// AccessRule restricts the client addresses of matching routes, e.g. admin
+// hosts to the office range. Every field that is set must match.
+type AccessRule struct {
+	Name string `json:"name,omitempty"`
+	// Hosts are globs such as "admin.*", matched like Rule.Hosts.
+	Hosts      []string `json:"hosts,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Allow replaces the route's own allowlist; Deny is added to its
+	// denylist. Entries are CIDRs or single addresses.
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+	// ProxyDepth overrides the agent's trusted proxy depth for these routes.
+	ProxyDepth *int `json:"proxyDepth,omitempty"`
+}
+
+// Access returns the first access rule matching ing.
+func (p *Policy) Access(ing renderer.Ingress) (AccessRule, bool) {
+	for _, rule := range p.AccessRules {
+		if rule.matches(ing) {
+			return rule, true
+		}
+	}
+	return AccessRule{}, false
+}
+
+func (r *AccessRule) matches(ing renderer.Ingress) bool {
+	if len(r.Hosts) > 0 && !matchAny(r.Hosts, ing.Host, matchHost) {
+		return false
+	}
+	return len(r.Namespaces) == 0 || matchAny(r.Namespaces, ing.Namespace, func(a, b string) bool { return a == b })
+}
+
+func (r *AccessRule) check() error {
+	for _, glob := range r.Hosts {
+		if err := checkHostGlob(glob); err != nil {
+			return err
+		}
+	}
+	var err error
+	if r.Allow, err = ParseCIDRs(r.Allow); err != nil {
+		return err
+	}
+	if r.Deny, err = ParseCIDRs(r.Deny); err != nil {
+		return err
+	}
+	if r.ProxyDepth != nil && *r.ProxyDepth < 0 {
+		return fmt.Errorf("proxyDepth %d is negative", *r.ProxyDepth)
+	}
+	return nil
+}
+
+// ParseCIDRs validates a list of CIDRs or addresses and returns it sorted
+// and without duplicates. Empty entries are skipped.
+func ParseCIDRs(list []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(s); err != nil && net.ParseIP(s) == nil {
+			return nil, fmt.Errorf("%q is not a CIDR or an IP address", s)
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,59 @@
+package policy
+
+import (
+	"testing"
+
+	"polaredge-agent/internal/renderer"
+)
+
+func TestAccess(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"rules": [],
+		"access": [
+			{"name": "admin", "hosts": ["admin.*.*"], "allow": ["198.51.100.0/24", "198.51.100.0/24", "192.0.2.7"]},
+			{"name": "ops", "namespaces": ["ops"], "deny": ["10.6.0.0/16"]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ing  renderer.Ingress
+		want string
+	}{
+		{"host glob", renderer.Ingress{Host: "admin.example.com"}, "admin"},
+		{"host glob is label-aware", renderer.Ingress{Host: "admin.shop.example.com"}, ""},
+		{"namespace", renderer.Ingress{Host: "grafana.example.com", Namespace: "ops"}, "ops"},
+		{"first match wins", renderer.Ingress{Host: "admin.example.com", Namespace: "ops"}, "admin"},
+		{"no match", renderer.Ingress{Host: "shop.example.com", Namespace: "shop"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := p.Access(tt.ing)
+			if rule.Name != tt.want || ok != (tt.want != "") {
+				t.Errorf("Access = %q, %t, want %q", rule.Name, ok, tt.want)
+			}
+		})
+	}
+
+	allow := p.AccessRules[0].Allow
+	if len(allow) != 2 || allow[0] != "192.0.2.7" || allow[1] != "198.51.100.0/24" {
+		t.Errorf("allowlist = %v, want it sorted and deduplicated", allow)
+	}
+}
+
+func TestParseAccessRejects(t *testing.T) {
+	tests := map[string]string{
+		"bad cidr":       `{"access": [{"allow": ["10.0.0.0/33"]}]}`,
+		"bad address":    `{"access": [{"deny": ["example.com"]}]}`,
+		"bad host glob":  `{"access": [{"hosts": ["admin.["], "allow": ["10.0.0.0/8"]}]}`,
+		"negative depth": `{"access": [{"allow": ["10.0.0.0/8"], "proxyDepth": -1}]}`,
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: Parse accepted %s", name, data)
+		}
+	}
+}
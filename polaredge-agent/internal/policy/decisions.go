@@ -0,0 +1,302 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"polaredge-agent/internal/fsutil"
+)
+
+// Record is an operator's exposure decision for one host and port. It takes
+// precedence over the policy rules until it expires or is revoked.
+type Record struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	Mode Mode   `json:"mode"`
+	// ExposePort, when set, is the host port the route is served on instead
+	// of :80. Traffic still goes to Port.
+	ExposePort int `json:"exposePort,omitempty"`
+
+	DecidedBy string     `json:"decidedBy"`
+	DecidedAt time.Time  `json:"decidedAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Note      string     `json:"note,omitempty"`
+}
+
+// Key identifies the route a record applies to.
+func (r Record) Key() string {
+	return recordKey(r.Host, r.Port)
+}
+
+// check validates a record, whether it is set through the agent or edited
+// into the file by hand.
+func (r Record) check() error {
+	if r.Host == "" {
+		return errors.New("no host")
+	}
+	if err := checkDecided(r.Mode); err != nil {
+		return err
+	}
+	if r.Port < 1 || r.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", r.Port)
+	}
+	if r.ExposePort < 0 || r.ExposePort > 65535 {
+		return fmt.Errorf("exposePort %d is out of range", r.ExposePort)
+	}
+	return nil
+}
+
+func (r Record) expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+func recordKey(host string, port int) string {
+	return host + ":" + strconv.Itoa(port)
+}
+
+// Decisions is the durable store of exposure decisions. The file may also be
+// edited by hand; changes are picked up by Watch.
+type Decisions struct {
+	path string
+
+	mu      sync.Mutex
+	records map[string]Record
+	stamp   stamp
+	// expiry is the next time a record expires, zero if none will.
+	expiry time.Time
+}
+
+// OpenDecisions loads the decisions stored at path, if any.
+func OpenDecisions(path string) (*Decisions, error) {
+	d := &Decisions{path: path, records: make(map[string]Record)}
+	if _, err := d.reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Lookup returns the unexpired decision for host and port.
+func (d *Decisions) Lookup(host string, port int) (Record, bool) {
+	if d == nil {
+		return Record{}, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r, ok := d.records[recordKey(host, port)]
+	if !ok || r.expired(time.Now()) {
+		return Record{}, false
+	}
+	return r, true
+}
+
+// List returns every unexpired decision, sorted by host and port.
+func (d *Decisions) List() []Record {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	out := make([]Record, 0, len(d.records))
+	for _, r := range d.records {
+		if !r.expired(now) {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].Port < out[j].Port
+	})
+	return out
+}
+
+// Set stores r, replacing any decision for the same host and port.
+func (d *Decisions) Set(r Record) error {
+	if err := r.check(); err != nil {
+		return err
+	}
+	if r.DecidedAt.IsZero() {
+		r.DecidedAt = time.Now()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.records[r.Key()] = r
+	return d.saveLocked()
+}
+
+// Revoke removes the decision for host and port and reports whether there
+// was one.
+func (d *Decisions) Revoke(host string, port int) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := recordKey(host, port)
+	if _, ok := d.records[key]; !ok {
+		return false, nil
+	}
+	delete(d.records, key)
+	return true, d.saveLocked()
+}
+
+// Watch re-reads the file every interval and calls onChange when it changed
+// or when a decision expired.
+func (d *Decisions) Watch(interval time.Duration, onChange func()) {
+	if d == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		changed, err := d.reload()
+		if err != nil {
+			log.Printf("⚠️  Keeping the previous exposure decisions: %v", err)
+		}
+		if changed {
+			log.Printf("📜 Exposure decisions reloaded from %s", d.path)
+		}
+		if d.expireDue() {
+			log.Println("⌛ An exposure decision expired")
+			changed = true
+		}
+		if changed {
+			onChange()
+		}
+	}
+}
+
+// expireDue reports whether a record expired since the last call.
+func (d *Decisions) expireDue() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expiry.IsZero() || time.Now().Before(d.expiry) {
+		return false
+	}
+	d.updateExpiryLocked()
+	return true
+}
+
+func (d *Decisions) updateExpiryLocked() {
+	now := time.Now()
+	d.expiry = time.Time{}
+	for _, r := range d.records {
+		if r.ExpiresAt != nil && r.ExpiresAt.After(now) && (d.expiry.IsZero() || r.ExpiresAt.Before(d.expiry)) {
+			d.expiry = *r.ExpiresAt
+		}
+	}
+}
+
+func (d *Decisions) reload() (bool, error) {
+	st, err := statFile(d.path)
+	if err != nil {
+		return false, err
+	}
+	d.mu.Lock()
+	unchanged := st == d.stamp
+	d.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	records, err := d.read(st)
+	if err != nil {
+		// Remember the version even though it is invalid, so it is reported
+		// once.
+		d.mu.Lock()
+		d.stamp = st
+		d.mu.Unlock()
+		return false, fmt.Errorf("parse %s: %w", d.path, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.records, d.stamp = records, st
+	d.updateExpiryLocked()
+	return true, nil
+}
+
+func (d *Decisions) read(st stamp) (map[string]Record, error) {
+	records := make(map[string]Record)
+	if !st.exists() {
+		return records, nil
+	}
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown fields are refused, so a misspelt key such as "expose_port" is
+	// reported instead of silently dropped.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var list []Record
+	if err := dec.Decode(&list); err != nil {
+		return nil, err
+	}
+	for i, r := range list {
+		if err := r.check(); err != nil {
+			return nil, fmt.Errorf("decision %d (%s): %w", i+1, r.Key(), err)
+		}
+		if _, dup := records[r.Key()]; dup {
+			return nil, fmt.Errorf("decision %d: %s is decided twice", i+1, r.Key())
+		}
+		records[r.Key()] = r
+	}
+	return records, nil
+}
+
+// saveLocked writes the unexpired records and remembers the file's new stamp,
+// so Watch does not report the agent's own write as a change.
+func (d *Decisions) saveLocked() error {
+	now := time.Now()
+	list := make([]Record, 0, len(d.records))
+	for key, r := range d.records {
+		if r.expired(now) {
+			delete(d.records, key)
+			continue
+		}
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key() < list[j].Key() })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(d.path, data, 0644); err != nil {
+		return err
+	}
+	d.updateExpiryLocked()
+	if st, err := statFile(d.path); err == nil {
+		d.stamp = st
+	}
+	return nil
+}
+
+// stamp identifies one version of a file; the zero stamp is a missing file.
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func (s stamp) exists() bool {
+	return !s.modTime.IsZero()
+}
+
+func statFile(path string) (stamp, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return stamp{}, nil
+	}
+	if err != nil {
+		return stamp{}, err
+	}
+	return stamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
@@ -0,0 +1,178 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeDecisions(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Give every version its own stamp, even within the file system's
+	// timestamp granularity.
+	stamp := time.Now().Add(time.Duration(len(data)) * time.Second)
+	if err := os.Chtimes(path, stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecisionsRejectBadRecords(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		err  string
+	}{
+		"bad mode":         {`[{"host": "a.example.com", "port": 8080, "mode": "pubic"}]`, "mode must be"},
+		"pending mode":     {`[{"host": "a.example.com", "port": 8080, "mode": "pending"}]`, "mode must be"},
+		"no host":          {`[{"port": 8080, "mode": "public"}]`, "no host"},
+		"port zero":        {`[{"host": "a.example.com", "mode": "public"}]`, "port 0 is out of range"},
+		"port too high":    {`[{"host": "a.example.com", "port": 80800, "mode": "public"}]`, "port 80800 is out of range"},
+		"bad expose port":  {`[{"host": "a.example.com", "port": 8080, "mode": "public", "exposePort": -1}]`, "exposePort -1"},
+		"misspelt field":   {`[{"host": "a.example.com", "port": 8080, "mode": "public", "expose_port": 8443}]`, "unknown field"},
+		"decided twice":    {`[{"host": "a.example.com", "port": 8080, "mode": "public"}, {"host": "a.example.com", "port": 8080, "mode": "off"}]`, "decided twice"},
+		"port as a string": {`[{"host": "a.example.com", "port": "8080", "mode": "public"}]`, "cannot unmarshal"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "decisions.json")
+			writeDecisions(t, path, tt.data)
+			_, err := OpenDecisions(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("OpenDecisions = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecisionsKeepPreviousOnBadEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.json")
+	writeDecisions(t, path, `[{"host": "a.example.com", "port": 8080, "mode": "private", "decidedBy": "ops"}]`)
+	d, err := OpenDecisions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeDecisions(t, path, `[{"host": "a.example.com", "port": 8080, "mode": "pubic", "decidedBy": "ops"}]`)
+	if changed, err := d.reload(); changed || err == nil {
+		t.Fatalf("reload of a bad edit = %t, %v, want an error", changed, err)
+	}
+	if r, ok := d.Lookup("a.example.com", 8080); !ok || r.Mode != Private {
+		t.Fatalf("Lookup after a bad edit = %+v, %t, want the previous private decision", r, ok)
+	}
+	// The bad version is reported once, not on every poll.
+	if changed, err := d.reload(); changed || err != nil {
+		t.Fatalf("second reload = %t, %v, want nothing new", changed, err)
+	}
+}
+
+func TestDecisionsSetValidates(t *testing.T) {
+	d, err := OpenDecisions(filepath.Join(t.TempDir(), "decisions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []Record{
+		{Host: "a.example.com", Port: 8080, Mode: Pending},
+		{Host: "a.example.com", Port: 0, Mode: Public},
+		{Host: "", Port: 8080, Mode: Public},
+		{Host: "a.example.com", Port: 8080, Mode: Public, ExposePort: 65536},
+	} {
+		if err := d.Set(r); err == nil {
+			t.Errorf("Set(%+v) succeeded", r)
+		}
+	}
+}
+
+func TestDecisionsSurviveReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "decisions.json")
+	d, err := OpenDecisions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour).Round(0)
+	for _, r := range []Record{
+		{Host: "grafana.example.com", Port: 3000, Mode: Private, DecidedBy: "ops", ExpiresAt: &expires, Note: "INC-42"},
+		{Host: "api.example.com", Port: 8080, Mode: Public, ExposePort: 8443, DecidedBy: "ops"},
+		{Host: "old.example.com", Port: 80, Mode: Off, DecidedBy: "prompt"},
+	} {
+		if err := d.Set(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, err := d.Revoke("old.example.com", 80); !ok || err != nil {
+		t.Fatalf("Revoke = %t, %v", ok, err)
+	}
+
+	reopened, err := OpenDecisions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reopened.List()
+	if len(got) != 2 {
+		t.Fatalf("reopened %d decisions, want 2: %+v", len(got), got)
+	}
+	if r := got[0]; r.Host != "api.example.com" || r.Mode != Public || r.ExposePort != 8443 || r.DecidedAt.IsZero() {
+		t.Errorf("first decision = %+v", r)
+	}
+	if r := got[1]; r.Mode != Private || r.Note != "INC-42" || r.ExpiresAt == nil || !r.ExpiresAt.Equal(expires) {
+		t.Errorf("second decision = %+v, want private until %v", r, expires)
+	}
+	if _, ok := reopened.Lookup("old.example.com", 80); ok {
+		t.Error("a revoked decision came back after reopening")
+	}
+	// The agent's own writes are not reported as hand edits.
+	if changed, err := d.reload(); changed || err != nil {
+		t.Errorf("reload after Set = %t, %v, want nothing new", changed, err)
+	}
+}
+
+func TestDecisionsExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.json")
+	d, err := OpenDecisions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(50 * time.Millisecond)
+	if err := d.Set(Record{Host: "grafana.example.com", Port: 3000, Mode: Public, ExpiresAt: &expires}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set(Record{Host: "api.example.com", Port: 8080, Mode: Private}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Lookup("grafana.example.com", 3000); !ok {
+		t.Fatal("Lookup before expiry found nothing")
+	}
+	if d.expireDue() {
+		t.Fatal("expireDue before expiry = true")
+	}
+
+	time.Sleep(time.Until(expires) + 10*time.Millisecond)
+	if _, ok := d.Lookup("grafana.example.com", 3000); ok {
+		t.Error("Lookup returned an expired decision")
+	}
+	if len(d.List()) != 1 {
+		t.Errorf("List = %+v, want only the unexpired decision", d.List())
+	}
+	// The expiry is reported once, so the routes are rendered once.
+	if !d.expireDue() {
+		t.Error("expireDue after expiry = false")
+	}
+	if d.expireDue() {
+		t.Error("expireDue reported the same expiry twice")
+	}
+
+	// The next write drops the expired record from the file.
+	if _, err := d.Revoke("api.example.com", 8080); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "grafana") {
+		t.Errorf("the expired decision is still stored:\n%s", data)
+	}
+}
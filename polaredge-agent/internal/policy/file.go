@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// File is a policy loaded from disk and reloaded when the file changes.
+type File struct {
+	path string
+
+	mu     sync.Mutex
+	policy *Policy
+	stamp  stamp
+}
+
+// Load reads the policy at path. A missing file yields an empty policy, so
+// the file can be created later while the agent runs, and removing it falls
+// back to the empty policy.
+func Load(path string) (*File, error) {
+	f := &File{path: path, policy: &Policy{Default: Pending}}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Policy returns the current policy. A nil File has an empty policy.
+func (f *File) Policy() *Policy {
+	if f == nil {
+		return &Policy{Default: Pending}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.policy
+}
+
+// Watch re-reads the file every interval and calls onChange after a new
+// policy was loaded. An invalid file is logged and the previous policy kept.
+func (f *File) Watch(interval time.Duration, onChange func()) {
+	if f == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		changed, err := f.reload()
+		if err != nil {
+			log.Printf("⚠️  Keeping the previous exposure policy: %v", err)
+			continue
+		}
+		if changed {
+			log.Printf("📜 Exposure policy reloaded from %s", f.path)
+			onChange()
+		}
+	}
+}
+
+// reload reads the file if it changed since the last read.
+func (f *File) reload() (bool, error) {
+	st, err := statFile(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	unchanged := st == f.stamp
+	f.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	p := &Policy{Default: Pending}
+	if st.exists() {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return false, err
+		}
+		p, err = Parse(data)
+		if err != nil {
+			// Remember the version even though it is invalid, so it is
+			// reported once.
+			f.mu.Lock()
+			f.stamp = st
+			f.mu.Unlock()
+			return false, fmt.Errorf("parse %s: %w", f.path, err)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.policy, f.stamp = p, st
+	return true, nil
+}
@@ -0,0 +1,241 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"polaredge-agent/internal/renderer"
+)
+
+// Mode is how a route is exposed.
+type Mode string
+
+const (
+	Public  Mode = "public"
+	Private Mode = "private"
+	Off     Mode = "off"
+	// Pending holds a route back until an operator approves or denies it.
+	Pending Mode = "pending"
+)
+
+// lowPortMax is the highest port exposed publicly when no rule matches.
+const lowPortMax = 443
+
+// Rule maps matching routes to an exposure mode. Every field that is set must
+// match; an empty rule matches everything.
+type Rule struct {
+	Name string `json:"name,omitempty"`
+	// Hosts are globs such as "*.example.com", matched label by label, so "*"
+	// does not cross dots.
+	Hosts      []string `json:"hosts,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Ports are single ports ("8080") or ranges ("7000-7100").
+	Ports  []string          `json:"ports,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Mode Mode `json:"mode"`
+	// Port, when set, is the host port the route is served on instead of
+	// :80. The backend keeps its own port.
+	Port int `json:"port,omitempty"`
+
+	ports []PortRange
+}
+
+// PortRange is an inclusive range of ports, written "8080" or "7000-7100".
+type PortRange struct{ Min, Max int }
+
+// Contains reports whether port is in the range.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.Min && port <= r.Max
+}
+
+// InPortRanges reports whether port is in any of ranges.
+func InPortRanges(ranges []PortRange, port int) bool {
+	for _, r := range ranges {
+		if r.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r PortRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// Policy is an ordered list of rules; the first matching rule wins.
+type Policy struct {
+	// Default applies to routes above port 443 that no rule matches; it is
+	// pending unless set. Routes on lower ports are public unless a rule says
+	// otherwise.
+	Default Mode   `json:"default,omitempty"`
+	Rules   []Rule `json:"rules"`
+	// AccessRules restrict who may reach the routes they match. Unlike
+	// Rules they apply whatever the exposure; the first match wins.
+	AccessRules []AccessRule `json:"access,omitempty"`
+}
+
+// Decision is the outcome of applying a policy to one route.
+type Decision struct {
+	Mode Mode
+	Port int
+	// Rule names the matching rule; empty when the default applied.
+	Rule    string
+	Matched bool
+}
+
+// Parse reads and validates a JSON policy.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if p.Default == "" {
+		p.Default = Pending
+	}
+	if err := checkMode(p.Default); err != nil {
+		return nil, fmt.Errorf("default: %w", err)
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := checkMode(rule.Mode); err != nil {
+			return nil, fmt.Errorf("%s: %w", rule.Name, err)
+		}
+		if rule.Port < 0 || rule.Port > 65535 {
+			return nil, fmt.Errorf("%s: invalid port %d", rule.Name, rule.Port)
+		}
+		for _, glob := range rule.Hosts {
+			if err := checkHostGlob(glob); err != nil {
+				return nil, fmt.Errorf("%s: %w", rule.Name, err)
+			}
+		}
+		for _, spec := range rule.Ports {
+			r, err := ParsePortRange(spec)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", rule.Name, err)
+			}
+			rule.ports = append(rule.ports, r)
+		}
+	}
+	for i := range p.AccessRules {
+		rule := &p.AccessRules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("access rule %d", i+1)
+		}
+		if err := rule.check(); err != nil {
+			return nil, fmt.Errorf("%s: %w", rule.Name, err)
+		}
+	}
+	return &p, nil
+}
+
+// Decide returns how ing should be exposed.
+func (p *Policy) Decide(ing renderer.Ingress) Decision {
+	for _, rule := range p.Rules {
+		if rule.matches(ing) {
+			return Decision{Mode: rule.Mode, Port: rule.Port, Rule: rule.Name, Matched: true}
+		}
+	}
+	if ing.ServicePort <= lowPortMax {
+		return Decision{Mode: Public}
+	}
+	return Decision{Mode: p.Default}
+}
+
+func (r *Rule) matches(ing renderer.Ingress) bool {
+	if len(r.Hosts) > 0 && !matchAny(r.Hosts, ing.Host, matchHost) {
+		return false
+	}
+	if len(r.Namespaces) > 0 && !matchAny(r.Namespaces, ing.Namespace, func(a, b string) bool { return a == b }) {
+		return false
+	}
+	if len(r.ports) > 0 && !InPortRanges(r.ports, ing.ServicePort) {
+		return false
+	}
+	for k, v := range r.Labels {
+		if ing.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHost matches host against glob one DNS label at a time, so both need
+// the same number of labels and "*" stays within one. Case is ignored.
+func matchHost(glob, host string) bool {
+	globs := strings.Split(strings.ToLower(strings.TrimSuffix(glob, ".")), ".")
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(host, ".")), ".")
+	if len(globs) != len(labels) {
+		return false
+	}
+	for i, g := range globs {
+		if ok, _ := path.Match(g, labels[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func checkHostGlob(glob string) error {
+	for _, g := range strings.Split(glob, ".") {
+		if _, err := path.Match(g, ""); err != nil || g == "" {
+			return fmt.Errorf("bad host glob %q", glob)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, p := range patterns {
+		if match(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkMode(m Mode) error {
+	switch m {
+	case Public, Private, Off, Pending:
+		return nil
+	}
+	return fmt.Errorf("mode must be public, private, off or pending, not %q", m)
+}
+
+// checkDecided accepts the modes an operator decision can set.
+func checkDecided(m Mode) error {
+	switch m {
+	case Public, Private, Off:
+		return nil
+	}
+	return fmt.Errorf("mode must be public, private or off, not %q", m)
+}
+
+// ParsePortRange reads a single port or a range of ports.
+func ParsePortRange(spec string) (PortRange, error) {
+	lo, hi, isRange := strings.Cut(spec, "-")
+	min, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("bad port %q", spec)
+	}
+	max := min
+	if isRange {
+		if max, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+			return PortRange{}, fmt.Errorf("bad port range %q", spec)
+		}
+	}
+	if min < 1 || max > 65535 || min > max {
+		return PortRange{}, fmt.Errorf("bad port range %q", spec)
+	}
+	return PortRange{min, max}, nil
+}
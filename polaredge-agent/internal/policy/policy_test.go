@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"testing"
+
+	"polaredge-agent/internal/renderer"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		glob, host string
+		want       bool
+	}{
+		{"shop.example.com", "shop.example.com", true},
+		{"shop.example.com", "SHOP.Example.com.", true},
+		{"*.example.com", "shop.example.com", true},
+		{"*.example.com", "a.shop.example.com", false},
+		{"*.example.com", "example.com", false},
+		{"*.*.example.com", "a.shop.example.com", true},
+		{"admin.*", "admin.local", true},
+		{"admin.*", "admin.example.com", false},
+		{"admin.*.*", "admin.example.com", true},
+		{"shop-?.example.com", "shop-1.example.com", true},
+		{"shop-[0-9].example.com", "shop-a.example.com", false},
+		{"*", "localhost", true},
+		{"*", "shop.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := matchHost(tt.glob, tt.host); got != tt.want {
+			t.Errorf("matchHost(%q, %q) = %t, want %t", tt.glob, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestCheckHostGlob(t *testing.T) {
+	tests := []struct {
+		glob string
+		ok   bool
+	}{
+		{"*.example.com", true},
+		{"admin.*", true},
+		{"shop-[0-9].example.com", true},
+		{"shop-[0-9.example.com", false},
+		{"shop..example.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := checkHostGlob(tt.glob); (err == nil) != tt.ok {
+			t.Errorf("checkHostGlob(%q) = %v, want ok %t", tt.glob, err, tt.ok)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"rules": [
+			{"name": "internal", "hosts": ["*.internal.example.com"], "mode": "private"},
+			{"name": "games", "ports": ["7000-7100"], "mode": "public", "port": 7000},
+			{"name": "staging", "namespaces": ["staging"], "labels": {"expose": "off"}, "mode": "off"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ing  renderer.Ingress
+		want Decision
+	}{
+		{"host rule",
+			renderer.Ingress{Host: "grafana.internal.example.com", ServicePort: 80},
+			Decision{Mode: Private, Rule: "internal", Matched: true}},
+		{"host rule is label-aware",
+			renderer.Ingress{Host: "a.grafana.internal.example.com", ServicePort: 80},
+			Decision{Mode: Public}},
+		{"port range",
+			renderer.Ingress{Host: "game.example.com", ServicePort: 7050},
+			Decision{Mode: Public, Port: 7000, Rule: "games", Matched: true}},
+		{"namespace and labels",
+			renderer.Ingress{Host: "shop.example.com", Namespace: "staging", ServicePort: 80, Labels: map[string]string{"expose": "off"}},
+			Decision{Mode: Off, Rule: "staging", Matched: true}},
+		{"labels must all match",
+			renderer.Ingress{Host: "shop.example.com", Namespace: "staging", ServicePort: 80},
+			Decision{Mode: Public}},
+		{"low port default",
+			renderer.Ingress{Host: "shop.example.com", ServicePort: 443},
+			Decision{Mode: Public}},
+		{"high port default",
+			renderer.Ingress{Host: "shop.example.com", ServicePort: 8080},
+			Decision{Mode: Pending}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Decide(tt.ing); got != tt.want {
+				t.Errorf("Decide = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := map[string]string{
+		"bad mode":       `{"rules": [{"mode": "open"}]}`,
+		"bad default":    `{"default": "maybe", "rules": []}`,
+		"bad port range": `{"rules": [{"ports": ["90-80"], "mode": "public"}]}`,
+		"bad host glob":  `{"rules": [{"hosts": ["[a.example.com"], "mode": "public"}]}`,
+		"bad rule port":  `{"rules": [{"mode": "public", "port": 70000}]}`,
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: Parse accepted %s", name, data)
+		}
+	}
+}
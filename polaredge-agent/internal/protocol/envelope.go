@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version is the envelope format understood by this agent.
+const Version = 1
+
+// Signature algorithms accepted in an envelope.
+const (
+	AlgHMACSHA256 = "hmac-sha256"
+	AlgEd25519    = "ed25519"
+)
+
+// Envelope wraps a manifest with the metadata needed to authenticate it.
+type Envelope struct {
+	Version    int             `json:"version"`
+	Client     string          `json:"client"`
+	Generation int64           `json:"generation"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Manifest   json.RawMessage `json:"manifest"`
+	Signature  *Signature      `json:"signature,omitempty"`
+}
+
+// Signature identifies the key and carries the signature over SigningBytes.
+type Signature struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"keyID"`
+	Value     []byte `json:"value"`
+}
+
+// Ack statuses.
+const (
+	// AckApplied means the generation is live in Traefik.
+	AckApplied = "applied"
+	// AckQueued means the generation was accepted but not applied within the
+	// ack timeout. Resending the same generation waits for it again.
+	AckQueued = "queued"
+	// AckRejected means the agent refused the envelope; Reason tells whether
+	// resending it can help.
+	AckRejected = "rejected"
+)
+
+// Reasons of a rejected ack. Only ReasonBadManifest and ReasonSuperseded are
+// final; the others may pass when the same generation is resent.
+const (
+	// ReasonBadManifest means the manifest cannot be parsed.
+	ReasonBadManifest = "bad-manifest"
+	// ReasonSuperseded means a newer generation from the client replaced it.
+	ReasonSuperseded = "superseded"
+	// ReasonMalformed means the envelope could not be read or decoded.
+	ReasonMalformed = "malformed"
+	// ReasonUnauthorized means the signature, timestamp or identity did not check out.
+	ReasonUnauthorized = "unauthorized"
+	// ReasonApplyFailed means rendering or applying the config failed.
+	ReasonApplyFailed = "apply-failed"
+)
+
+// Ack is the agent's reply to a delivered envelope.
+type Ack struct {
+	Status            string `json:"status"`
+	Generation        int64  `json:"generation,omitempty"`
+	AppliedGeneration int64  `json:"appliedGeneration,omitempty"`
+	Error             string `json:"error,omitempty"`
+	// Reason classifies a rejection, see ReasonBadManifest.
+	Reason string `json:"reason,omitempty"`
+	// Pending lists the client's routes ("host:port") held back until the
+	// edge operator approves them.
+	Pending []string `json:"pending,omitempty"`
+	// Rejected lists the client's routes left out as invalid or conflicting,
+	// each as "host/path:port: reason".
+	Rejected []string `json:"rejected,omitempty"`
+	// ConfigHash identifies the config the agent runs with.
+	ConfigHash string `json:"configHash,omitempty"`
+}
+
+// Decode parses an envelope and canonicalizes its manifest so that the
+// signature check and the renderer see exactly the same bytes.
+func Decode(data []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("decode envelope: %w", err)
+	}
+	if env.Version != Version {
+		return nil, fmt.Errorf("unsupported envelope version %d", env.Version)
+	}
+	if len(env.Manifest) == 0 {
+		return nil, fmt.Errorf("envelope has no manifest")
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, env.Manifest); err != nil {
+		return nil, fmt.Errorf("compact manifest: %w", err)
+	}
+	env.Manifest = buf.Bytes()
+	return &env, nil
+}
+
+// SigningBytes returns the byte string covered by the envelope signature.
+func (e *Envelope) SigningBytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "polaredge/v%d\n%s\n%d\n%d\n", e.Version, e.Client, e.Generation, e.Timestamp.UnixNano())
+	buf.Write(e.Manifest)
+	return buf.Bytes()
+}
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A frame carries one (possibly compressed) envelope:
+//
+//	"PEF1" | encoding (1 byte) | payload length (uint32, big endian) | payload
+//
+// Connections that start with '{' instead are read as a bare JSON envelope,
+// as sent by clients that predate framing.
+var frameMagic = []byte("PEF1")
+
+// Payload encodings signalled in the frame header. Code 2 is reserved for zstd.
+const (
+	EncodingIdentity byte = 0
+	EncodingGzip     byte = 1
+)
+
+// ErrTooLarge is returned when a payload exceeds the configured limits.
+var ErrTooLarge = errors.New("payload too large")
+
+// ReadEnvelope reads one envelope from r, framed or bare. maxWire limits the
+// bytes read from the connection, maxDecoded the size after decompression.
+func ReadEnvelope(r *bufio.Reader, maxWire, maxDecoded int64) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != frameMagic[0] {
+		var raw json.RawMessage
+		if err := json.NewDecoder(io.LimitReader(r, maxWire)).Decode(&raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("read frame header: %w", err)
+	}
+	if !bytes.Equal(header[:4], frameMagic) {
+		return nil, errors.New("bad frame magic")
+	}
+	encoding := header[4]
+	length := int64(binary.BigEndian.Uint32(header[5:]))
+	if length > maxWire {
+		return nil, fmt.Errorf("%w: frame of %d bytes exceeds %d", ErrTooLarge, length, maxWire)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("read frame payload: %w", err)
+	}
+	return Decompress(encoding, payload, maxDecoded)
+}
+
+// Decompress decodes payload, refusing to produce more than max bytes so a
+// small compressed frame cannot expand into an unbounded allocation.
+func Decompress(encoding byte, payload []byte, max int64) ([]byte, error) {
+	switch encoding {
+	case EncodingIdentity:
+		if int64(len(payload)) > max {
+			return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLarge, len(payload), max)
+		}
+		return payload, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		return readLimited(zr, max)
+	default:
+		return nil, fmt.Errorf("unsupported payload encoding %d", encoding)
+	}
+}
+
+// EncodingByName maps an HTTP Content-Encoding value to a frame encoding.
+func EncodingByName(name string) (byte, error) {
+	switch name {
+	case "", "identity":
+		return EncodingIdentity, nil
+	case "gzip":
+		return EncodingGzip, nil
+	default:
+		return 0, fmt.Errorf("unsupported content encoding %q", name)
+	}
+}
+
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: decompressed manifest exceeds %d bytes", ErrTooLarge, max)
+	}
+	return data, nil
+}
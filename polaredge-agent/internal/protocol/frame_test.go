@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func frame(encoding byte, payload []byte) []byte {
+	header := make([]byte, 9)
+	copy(header, frameMagic)
+	header[4] = encoding
+	binary.BigEndian.PutUint32(header[5:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadEnvelopeDecompressionCap(t *testing.T) {
+	const maxWire, maxDecoded = 64 << 10, 256 << 10
+	manifest := []byte(`{"version":1,"client":"c1","manifest":[]}`)
+	// A few kilobytes on the wire that expand to 16 MiB.
+	bomb := gzipped(t, bytes.Repeat([]byte{' '}, 16<<20))
+	if len(bomb) > maxWire {
+		t.Fatalf("the bomb is %d bytes on the wire, want it under maxWire", len(bomb))
+	}
+	exact := bytes.Repeat([]byte{'x'}, maxDecoded)
+
+	tests := map[string]struct {
+		wire []byte
+		want []byte
+		err  error
+	}{
+		"gzip":                  {wire: frame(EncodingGzip, gzipped(t, manifest)), want: manifest},
+		"gzip at the cap":       {wire: frame(EncodingGzip, gzipped(t, exact)), want: exact},
+		"gzip over the cap":     {wire: frame(EncodingGzip, gzipped(t, append(exact, 'x'))), err: ErrTooLarge},
+		"gzip bomb":             {wire: frame(EncodingGzip, bomb), err: ErrTooLarge},
+		"identity":              {wire: frame(EncodingIdentity, manifest), want: manifest},
+		"frame over maxWire":    {wire: frame(EncodingIdentity, make([]byte, maxWire+1)), err: ErrTooLarge},
+		"bare JSON":             {wire: append(append([]byte(nil), manifest...), '\n'), want: manifest},
+		"length beyond payload": {wire: frame(EncodingGzip, gzipped(t, manifest))[:20]},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ReadEnvelope(bufio.NewReader(bytes.NewReader(tt.wire)), maxWire, maxDecoded)
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+			case tt.want == nil:
+				if err == nil {
+					t.Fatal("a truncated frame was accepted")
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !bytes.Equal(got, tt.want):
+				t.Fatalf("got %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestDecompressRejectsUnknownEncoding(t *testing.T) {
+	_, err := Decompress(2, []byte("zstd"), 1<<10)
+	if err == nil || !strings.Contains(err.Error(), "unsupported payload encoding 2") {
+		t.Fatalf("Decompress = %v, want an unsupported encoding error", err)
+	}
+}
@@ -0,0 +1,51 @@
+package renderer
+
+// DashboardEntryPoint serves Traefik's API and dashboard, see DashboardOptions.
+const DashboardEntryPoint = "polaredge-dashboard"
+
+// DashboardOptions enables Traefik's API and dashboard on an entrypoint of
+// its own. Users, UsersFile and AllowFrom guard it; the agent requires at
+// least one of them.
+type DashboardOptions struct {
+	// Address is where the entrypoint listens, on the private address.
+	Address string
+	// Users are htpasswd lines ("name:hash"), UsersFile an htpasswd file.
+	Users     []string
+	UsersFile string
+	// AllowFrom restricts the client addresses (CIDRs or IPs).
+	AllowFrom []string
+}
+
+// BasicAuth asks for a user from Users or UsersFile.
+type BasicAuth struct {
+	Users     []string `json:"users,omitempty" toml:"users,omitempty" yaml:"users,omitempty"`
+	UsersFile string   `json:"usersFile,omitempty" toml:"usersFile,omitempty" yaml:"usersFile,omitempty"`
+}
+
+// AddDashboard routes the dashboard entrypoint to Traefik's api@internal
+// service, behind the guards of d.
+func (c *DynamicConfig) AddDashboard(d *DashboardOptions) {
+	if c.HTTP == nil {
+		c.HTTP = &HTTPConfig{}
+	}
+	if c.HTTP.Routers == nil {
+		c.HTTP.Routers = make(map[string]*Router)
+	}
+	if c.HTTP.Middlewares == nil {
+		c.HTTP.Middlewares = make(map[string]*Middleware)
+	}
+	router := &Router{
+		EntryPoints: []string{DashboardEntryPoint},
+		Rule:        "PathPrefix(`/api`) || PathPrefix(`/dashboard`)",
+		Service:     "api@internal",
+	}
+	if len(d.AllowFrom) > 0 {
+		c.HTTP.Middlewares[DashboardEntryPoint+"-allowlist"] = &Middleware{IPAllowList: &IPAllowList{SourceRange: d.AllowFrom}}
+		router.Middlewares = append(router.Middlewares, DashboardEntryPoint+"-allowlist")
+	}
+	if len(d.Users) > 0 || d.UsersFile != "" {
+		c.HTTP.Middlewares[DashboardEntryPoint+"-auth"] = &Middleware{BasicAuth: &BasicAuth{Users: d.Users, UsersFile: d.UsersFile}}
+		router.Middlewares = append(router.Middlewares, DashboardEntryPoint+"-auth")
+	}
+	c.HTTP.Routers[DashboardEntryPoint] = router
+}
@@ -0,0 +1,350 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats the dynamic config can be written in.
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+)
+
+// CheckFormat reports whether format is one the dynamic config can be written in.
+func CheckFormat(format string) error {
+	switch format {
+	case FormatTOML, FormatYAML:
+		return nil
+	default:
+		return fmt.Errorf("unknown dynamic config format %q (want %s or %s)", format, FormatTOML, FormatYAML)
+	}
+}
+
+// DynamicConfig is the part of Traefik's dynamic configuration the agent
+// writes for the file provider.
+type DynamicConfig struct {
+	HTTP *HTTPConfig `json:"http,omitempty" toml:"http,omitempty" yaml:"http,omitempty"`
+	TLS  *TLSConfig  `json:"tls,omitempty" toml:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// TLSConfig lists the certificates loaded into Traefik's TLS store.
+type TLSConfig struct {
+	Certificates []Certificate `json:"certificates" toml:"certificates" yaml:"certificates"`
+}
+
+// Certificate is a certificate and key file pair; Traefik picks it by SNI.
+type Certificate struct {
+	CertFile string   `json:"certFile" toml:"certFile" yaml:"certFile"`
+	KeyFile  string   `json:"keyFile" toml:"keyFile" yaml:"keyFile"`
+	Stores   []string `json:"stores" toml:"stores" yaml:"stores"`
+}
+
+// HTTPConfig holds the HTTP routers, middlewares and services.
+type HTTPConfig struct {
+	Routers     map[string]*Router     `json:"routers,omitempty" toml:"routers,omitempty" yaml:"routers,omitempty"`
+	Middlewares map[string]*Middleware `json:"middlewares,omitempty" toml:"middlewares,omitempty" yaml:"middlewares,omitempty"`
+	Services    map[string]*Service    `json:"services,omitempty" toml:"services,omitempty" yaml:"services,omitempty"`
+}
+
+// Router matches requests on its entrypoints and hands them to a service.
+type Router struct {
+	EntryPoints []string   `json:"entryPoints" toml:"entryPoints" yaml:"entryPoints"`
+	Rule        string     `json:"rule" toml:"rule" yaml:"rule"`
+	Service     string     `json:"service" toml:"service" yaml:"service"`
+	Middlewares []string   `json:"middlewares,omitempty" toml:"middlewares,omitempty" yaml:"middlewares,omitempty"`
+	TLS         *RouterTLS `json:"tls,omitempty" toml:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// Middleware transforms or filters requests before they reach a service.
+type Middleware struct {
+	IPAllowList *IPAllowList `json:"ipAllowList,omitempty" toml:"ipAllowList,omitempty" yaml:"ipAllowList,omitempty"`
+	BasicAuth   *BasicAuth   `json:"basicAuth,omitempty" toml:"basicAuth,omitempty" yaml:"basicAuth,omitempty"`
+}
+
+// IPAllowList rejects requests from outside SourceRange with 403.
+type IPAllowList struct {
+	SourceRange []string    `json:"sourceRange" toml:"sourceRange" yaml:"sourceRange"`
+	IPStrategy  *IPStrategy `json:"ipStrategy,omitempty" toml:"ipStrategy,omitempty" yaml:"ipStrategy,omitempty"`
+}
+
+// IPStrategy takes the client address from X-Forwarded-For, Depth entries
+// from the right, instead of from the connection.
+type IPStrategy struct {
+	Depth int `json:"depth" toml:"depth" yaml:"depth"`
+}
+
+// RouterTLS terminates TLS on the router, with a certificate from
+// CertResolver or, when that is empty, from the TLS store.
+type RouterTLS struct {
+	CertResolver string `json:"certResolver,omitempty" toml:"certResolver,omitempty" yaml:"certResolver,omitempty"`
+}
+
+// Service balances requests over its servers.
+type Service struct {
+	LoadBalancer *LoadBalancer `json:"loadBalancer" toml:"loadBalancer" yaml:"loadBalancer"`
+}
+
+// LoadBalancer lists the backend servers of a service.
+type LoadBalancer struct {
+	Servers     []Server     `json:"servers" toml:"servers" yaml:"servers"`
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty" toml:"healthCheck,omitempty" yaml:"healthCheck,omitempty"`
+}
+
+// HealthCheck makes Traefik probe every server and stop sending traffic to
+// the ones that fail. Scheme defaults to the server's, and any 2xx or 3xx
+// answer is healthy unless Status is set.
+type HealthCheck struct {
+	Scheme   string `json:"scheme,omitempty" toml:"scheme,omitempty" yaml:"scheme,omitempty"`
+	Path     string `json:"path" toml:"path" yaml:"path"`
+	Interval string `json:"interval,omitempty" toml:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout  string `json:"timeout,omitempty" toml:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Status   int    `json:"status,omitempty" toml:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// Server is one backend URL.
+type Server struct {
+	URL string `json:"url" toml:"url" yaml:"url"`
+}
+
+// BuildDynamic builds the dynamic config for the routes: one router per route
+// and one service per backend, see serviceNames. The result does not depend
+// on the order of ingresses; the encoders sort map keys.
+func BuildDynamic(ingresses []Ingress) *DynamicConfig {
+	http := &HTTPConfig{
+		Routers:  make(map[string]*Router),
+		Services: make(map[string]*Service),
+	}
+	certs := make(map[string]Certificate)
+	deny := hostDenyLists(ingresses)
+	sorted := SortedIngresses(ingresses)
+	services := serviceNames(sorted)
+
+	for _, ing := range sorted {
+		ing.DenyFrom = deny[ing.Host]
+		service := services[backendKey(ing)]
+		router := &Router{
+			EntryPoints: []string{EntryPointName(ing)},
+			Rule:        routerRule(ing),
+			Service:     service,
+		}
+		switch ing.TLS {
+		case TLSACME:
+			router.TLS = &RouterTLS{CertResolver: CertResolver}
+		case TLSInternal:
+			router.TLS = &RouterTLS{}
+			certs[ing.CertFile] = Certificate{CertFile: ing.CertFile, KeyFile: ing.KeyFile, Stores: []string{"default"}}
+		}
+		name := routerName(http.Routers, service, router)
+		if len(ing.AllowFrom) > 0 {
+			allow := &IPAllowList{SourceRange: ing.AllowFrom}
+			if ing.ProxyDepth > 0 {
+				allow.IPStrategy = &IPStrategy{Depth: ing.ProxyDepth}
+			}
+			if http.Middlewares == nil {
+				http.Middlewares = make(map[string]*Middleware)
+			}
+			http.Middlewares[name+"-allowlist"] = &Middleware{IPAllowList: allow}
+			router.Middlewares = []string{name + "-allowlist"}
+		}
+		http.Routers[name] = router
+
+		svc, ok := http.Services[service]
+		if !ok {
+			svc = &Service{LoadBalancer: &LoadBalancer{}}
+			http.Services[service] = svc
+		}
+		// Routes share the service; the first one with a health check sets it.
+		if svc.LoadBalancer.HealthCheck == nil {
+			svc.LoadBalancer.HealthCheck = ing.HealthCheck
+		}
+		for _, url := range backendURLs(ing) {
+			if !hasServer(svc.LoadBalancer.Servers, url) {
+				svc.LoadBalancer.Servers = append(svc.LoadBalancer.Servers, Server{URL: url})
+			}
+		}
+	}
+	for _, svc := range http.Services {
+		servers := svc.LoadBalancer.Servers
+		sort.Slice(servers, func(i, j int) bool { return servers[i].URL < servers[j].URL })
+	}
+
+	cfg := &DynamicConfig{HTTP: http}
+	if len(certs) > 0 {
+		cfg.TLS = &TLSConfig{}
+		for _, c := range certs {
+			cfg.TLS.Certificates = append(cfg.TLS.Certificates, c)
+		}
+		sort.Slice(cfg.TLS.Certificates, func(i, j int) bool {
+			return cfg.TLS.Certificates[i].CertFile < cfg.TLS.Certificates[j].CertFile
+		})
+	}
+	return cfg
+}
+
+// SortedIngresses orders routes by host, path, entrypoint, service and origin, so that
+// numbered router names and other choices between routes are stable.
+func SortedIngresses(ingresses []Ingress) []Ingress {
+	sorted := append([]Ingress(nil), ingresses...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case a.Host != b.Host:
+			return a.Host < b.Host
+		case a.Path != b.Path:
+			return a.Path < b.Path
+		case EntryPointName(a) != EntryPointName(b):
+			return EntryPointName(a) < EntryPointName(b)
+		case a.ServiceName != b.ServiceName:
+			return a.ServiceName < b.ServiceName
+		case a.ServicePort != b.ServicePort:
+			return a.ServicePort < b.ServicePort
+		case a.Namespace != b.Namespace:
+			return a.Namespace < b.Namespace
+		default:
+			return a.Source < b.Source
+		}
+	})
+	return sorted
+}
+
+// Encode serializes the config in the given format.
+func (c *DynamicConfig) Encode(format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatTOML:
+		if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+			return nil, fmt.Errorf("encode toml: %w", err)
+		}
+	case FormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(c); err != nil {
+			return nil, fmt.Errorf("encode yaml: %w", err)
+		}
+		if err := enc.Close(); err != nil {
+			return nil, fmt.Errorf("encode yaml: %w", err)
+		}
+	default:
+		return nil, CheckFormat(format)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderDynamic renders the routers and services Traefik's file provider
+// picks up without a restart.
+func RenderDynamic(ingresses []Ingress, format string) (string, error) {
+	data, err := BuildDynamic(ingresses).Encode(format)
+	return string(data), err
+}
+
+// routerRule matches the route's host and path. Denied addresses are
+// excluded in the rule itself, so their requests match no router (404).
+// ClientIP looks at the connection's address, not X-Forwarded-For.
+func routerRule(ing Ingress) string {
+	rule := fmt.Sprintf("Host(`%s`)", ing.Host)
+	if ing.Path != "" && ing.Path != "/" {
+		rule += fmt.Sprintf(" && PathPrefix(`%s`)", ing.Path)
+	}
+	for _, cidr := range ing.DenyFrom {
+		rule += fmt.Sprintf(" && !ClientIP(`%s`)", cidr)
+	}
+	return rule
+}
+
+// hostDenyLists merges the denylists of all routes of a host. Every router of
+// the host excludes them, so a denied request cannot fall through to another
+// path's router.
+func hostDenyLists(ingresses []Ingress) map[string][]string {
+	seen := make(map[string]map[string]bool)
+	out := make(map[string][]string)
+	for _, ing := range ingresses {
+		for _, cidr := range ing.DenyFrom {
+			if seen[ing.Host] == nil {
+				seen[ing.Host] = make(map[string]bool)
+			}
+			if !seen[ing.Host][cidr] {
+				seen[ing.Host][cidr] = true
+				out[ing.Host] = append(out[ing.Host], cidr)
+			}
+		}
+	}
+	for _, list := range out {
+		sort.Strings(list)
+	}
+	return out
+}
+
+// serviceNames names one service per backend: source, namespace, service and
+// port, so equally named services of different clients or namespaces never
+// share a load balancer or health check. Backends whose names sanitize alike
+// are numbered.
+func serviceNames(sorted []Ingress) map[string]string {
+	names := make(map[string]string)
+	taken := make(map[string]bool)
+	for _, ing := range sorted {
+		backend := backendKey(ing)
+		if _, ok := names[backend]; ok {
+			continue
+		}
+		base := sanitizeName(backend)
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = base + "-" + strconv.Itoa(n)
+		}
+		taken[name] = true
+		names[backend] = name
+	}
+	return names
+}
+
+func backendKey(ing Ingress) string {
+	return fmt.Sprintf("%s/%s/%s/%d", ing.Source, ing.Namespace, ing.ServiceName, ing.ServicePort)
+}
+
+// sanitizeName keeps lowercase letters and digits, joining the rest with
+// single dashes, so names are safe as Traefik keys.
+func sanitizeName(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(s) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// routerName names routers after their service. Routes of the same service
+// on other hosts, paths or entrypoints get a numbered name of their own.
+func routerName(routers map[string]*Router, service string, r *Router) string {
+	name := service
+	for n := 2; ; n++ {
+		existing, ok := routers[name]
+		if !ok || (existing.Rule == r.Rule && existing.EntryPoints[0] == r.EntryPoints[0]) {
+			return name
+		}
+		name = service + "-" + strconv.Itoa(n)
+	}
+}
+
+func hasServer(servers []Server, url string) bool {
+	for _, s := range servers {
+		if s.URL == url {
+			return true
+		}
+	}
+	return false
+}
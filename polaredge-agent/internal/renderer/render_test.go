@@ -0,0 +1,250 @@
+package renderer
+
+import (
+	"flag"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenCase is one route set rendered the way the agent writes it.
+type goldenCase struct {
+	name   string
+	routes []Ingress
+	opts   StaticOptions
+}
+
+func goldenCases() []goldenCase {
+	base := StaticOptions{
+		DynamicDir:     "/etc/traefik/dynamic",
+		PingAddress:    "127.0.0.1:8082",
+		PublicAddress:  "203.0.113.5",
+		PrivateAddress: "10.88.0.1",
+	}
+	withOpts := func(edit func(*StaticOptions)) StaticOptions {
+		opts := base
+		edit(&opts)
+		return opts
+	}
+
+	return []goldenCase{
+		{
+			name: "basic",
+			opts: base,
+			routes: []Ingress{
+				{Source: "c1", Namespace: "shop", Host: "shop.example.com", ServiceName: "web", ServicePort: 80, Exposure: "public"},
+				{Source: "c1", Namespace: "shop", Host: "shop.example.com", Path: "/api", ServiceName: "api", ServicePort: 8080, Exposure: "public",
+					Endpoints: []string{"10.42.0.12:8080", "10.42.0.11:8080"}},
+				{Source: "c1", Namespace: "blog", Host: "blog.example.com", ServiceName: "web", ServicePort: 80, Exposure: "public"},
+				{Source: "c2", Namespace: "shop", Host: "other.example.com", ServiceName: "web", ServicePort: 80, Exposure: "public"},
+				{Source: "c1", Namespace: "ops", Host: "grafana.example.com", ServiceName: "grafana", ServicePort: 3000, Exposure: "private"},
+				{Source: "c1", Namespace: "shop", Host: "shop.example.com", Path: "/ws", ServiceName: "ws", ServicePort: 7000, Exposure: "public", ListenPort: 7000},
+			},
+		},
+		{
+			name: "tls",
+			opts: withOpts(func(o *StaticOptions) {
+				o.ACME = &ACMEOptions{Email: "ops@example.com", Storage: "/var/lib/polaredge/acme.json"}
+			}),
+			routes: []Ingress{
+				{Source: "c1", Namespace: "shop", Host: "shop.example.com", ServiceName: "web", ServicePort: 80, Exposure: "public",
+					ListenPort: WebSecurePort, TLS: TLSACME},
+				{Source: "c1", Namespace: "ops", Host: "grafana.example.com", ServiceName: "grafana", ServicePort: 3000, Exposure: "private",
+					ListenPort: WebSecurePort, TLS: TLSInternal,
+					CertFile: "/var/lib/polaredge/ca/grafana.example.com.crt", KeyFile: "/var/lib/polaredge/ca/grafana.example.com.key"},
+				{Source: "c1", Namespace: "ops", Host: "prom.example.com", ServiceName: "prometheus", ServicePort: 9090, Exposure: "private",
+					ListenPort: WebSecurePort, TLS: TLSInternal,
+					CertFile: "/var/lib/polaredge/ca/prom.example.com.crt", KeyFile: "/var/lib/polaredge/ca/prom.example.com.key"},
+			},
+		},
+		{
+			name: "healthcheck",
+			opts: base,
+			routes: []Ingress{
+				{Source: "c1", Namespace: "shop", Host: "shop.example.com", ServiceName: "web", ServicePort: 80, Exposure: "public",
+					HealthCheck: &HealthCheck{Path: "/healthz", Interval: "10s", Timeout: "5s"}},
+				{Source: "c1", Namespace: "shop", Host: "api.example.com", ServiceName: "api", ServicePort: 8080, Exposure: "public",
+					HealthCheck: &HealthCheck{Path: "/ready", Scheme: "https", Interval: "30s", Timeout: "2s", Status: 204}},
+				{Source: "c1", Namespace: "shop", Host: "static.example.com", ServiceName: "static", ServicePort: 80, Exposure: "public"},
+			},
+		},
+		{
+			name: "access",
+			opts: base,
+			routes: []Ingress{
+				{Source: "c1", Namespace: "admin", Host: "admin.example.com", ServiceName: "admin", ServicePort: 80, Exposure: "public",
+					AllowFrom: []string{"198.51.100.0/24"}, ProxyDepth: 1},
+				{Source: "c1", Namespace: "shop", Host: "shop.example.com", Path: "/admin", ServiceName: "shop-admin", ServicePort: 80, Exposure: "public",
+					DenyFrom: []string{"192.0.2.0/24", "10.6.0.0/16"}},
+				{Source: "c1", Namespace: "shop", Host: "shop.example.com", ServiceName: "web", ServicePort: 80, Exposure: "public"},
+			},
+		},
+		{
+			name: "dashboard",
+			opts: withOpts(func(o *StaticOptions) {
+				o.Dashboard = &DashboardOptions{
+					Address:   "10.88.0.1:8080",
+					Users:     []string{"ops:$apr1$abc$def"},
+					AllowFrom: []string{"10.88.0.0/24"},
+				}
+			}),
+			routes: []Ingress{
+				{Source: "c1", Namespace: "shop", Host: "shop.example.com", ServiceName: "web", ServicePort: 80, Exposure: "public"},
+			},
+		},
+	}
+}
+
+// render produces the static config and the dynamic config in both formats.
+func (c goldenCase) render(t *testing.T, routes []Ingress) map[string]string {
+	t.Helper()
+	static, err := RenderStaticTOML(routes, c.opts)
+	if err != nil {
+		t.Fatalf("encode static: %v", err)
+	}
+	out := map[string]string{"static.toml": static}
+	for _, format := range []string{FormatTOML, FormatYAML} {
+		model := BuildDynamic(routes)
+		if c.opts.Dashboard != nil {
+			model.AddDashboard(c.opts.Dashboard)
+		}
+		data, err := model.Encode(format)
+		if err != nil {
+			t.Fatalf("encode %s: %v", format, err)
+		}
+		out["dynamic."+format] = string(data)
+	}
+	return out
+}
+
+func TestGolden(t *testing.T) {
+	for _, c := range goldenCases() {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.render(t, c.routes)
+			for suffix, data := range got {
+				path := filepath.Join("testdata", c.name+"."+suffix)
+				if *update {
+					if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("%v (run with -update to create it)", err)
+				}
+				if data != string(want) {
+					t.Errorf("%s differs from the golden file:\n--- got\n%s\n--- want\n%s", path, data, want)
+				}
+			}
+
+			// The output must not depend on the order routes arrive in.
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < 20; i++ {
+				shuffled := append([]Ingress(nil), c.routes...)
+				rng.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+				for suffix, data := range c.render(t, shuffled) {
+					if data != got[suffix] {
+						t.Fatalf("%s changes with the route order", suffix)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRouterRule(t *testing.T) {
+	tests := []struct {
+		name string
+		ing  Ingress
+		want string
+	}{
+		{"host", Ingress{Host: "a.example.com"}, "Host(`a.example.com`)"},
+		{"root path", Ingress{Host: "a.example.com", Path: "/"}, "Host(`a.example.com`)"},
+		{"path", Ingress{Host: "a.example.com", Path: "/api"}, "Host(`a.example.com`) && PathPrefix(`/api`)"},
+		{"deny", Ingress{Host: "a.example.com", DenyFrom: []string{"10.0.0.0/8"}}, "Host(`a.example.com`) && !ClientIP(`10.0.0.0/8`)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routerRule(tt.ing); got != tt.want {
+				t.Errorf("routerRule = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceNames(t *testing.T) {
+	routes := SortedIngresses([]Ingress{
+		{Source: "c1", Namespace: "a", ServiceName: "web", ServicePort: 80},
+		{Source: "c1", Namespace: "b", ServiceName: "web", ServicePort: 80},
+		{Source: "c1", Namespace: "a-b", ServiceName: "web", ServicePort: 80, Host: "z.example.com"},
+		{Source: "c1-a", Namespace: "b", ServiceName: "web", ServicePort: 80, Host: "z.example.com"},
+		{Source: "intent:api", ServiceName: "api", ServicePort: 3000},
+	})
+	names := serviceNames(routes)
+	want := map[string]string{
+		"c1/a/web/80":          "c1-a-web-80",
+		"c1/b/web/80":          "c1-b-web-80",
+		"c1/a-b/web/80":        "c1-a-b-web-80",
+		"c1-a/b/web/80":        "c1-a-b-web-80-2",
+		"intent:api//api/3000": "intent-api-api-3000",
+	}
+	for backend, name := range want {
+		if names[backend] != name {
+			t.Errorf("service of %s = %q, want %q", backend, names[backend], name)
+		}
+	}
+}
+
+func TestCheckAddresses(t *testing.T) {
+	tests := []struct {
+		public, private string
+		ok              bool
+	}{
+		{"", "", true},
+		{"203.0.113.5", "10.88.0.1", true},
+		{"", "10.88.0.1", false},
+		{"0.0.0.0", "10.88.0.1", false},
+		{"10.88.0.1", "10.88.0.1", false},
+	}
+	for _, tt := range tests {
+		if err := CheckAddresses(tt.public, tt.private); (err == nil) != tt.ok {
+			t.Errorf("CheckAddresses(%q, %q) = %v, want ok %t", tt.public, tt.private, err, tt.ok)
+		}
+	}
+}
+
+func TestStaticEscapesValues(t *testing.T) {
+	opts := StaticOptions{
+		DynamicDir: `C:\traefik "dynamic"`,
+		LogLevel:   "debug\n[api]\n  insecure = true",
+		ACME:       &ACMEOptions{Email: "ops\"@example.com", Storage: "/var/lib/acme.json"},
+	}
+	static, err := RenderStaticTOML(nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got staticConfig
+	if _, err := toml.Decode(static, &got); err != nil {
+		t.Fatalf("decode:\n%s\n%v", static, err)
+	}
+	if got.Providers.File.Directory != opts.DynamicDir {
+		t.Errorf("directory = %q, want %q", got.Providers.File.Directory, opts.DynamicDir)
+	}
+	if got.Log.Level != strings.ToUpper(opts.LogLevel) {
+		t.Errorf("log level = %q, want %q", got.Log.Level, strings.ToUpper(opts.LogLevel))
+	}
+	if email := got.CertificatesResolvers[CertResolver].ACME.Email; email != opts.ACME.Email {
+		t.Errorf("email = %q, want %q", email, opts.ACME.Email)
+	}
+	if got.API.Dashboard {
+		t.Error("a value escaped its string and enabled the API")
+	}
+}
@@ -0,0 +1,124 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// staticConfig is the part of Traefik's static configuration the agent
+// writes. It goes through the TOML encoder like the dynamic config, so
+// addresses, paths and the ACME email are quoted and escaped.
+type staticConfig struct {
+	EntryPoints           map[string]entryPoint   `toml:"entryPoints"`
+	Ping                  *ping                   `toml:"ping,omitempty"`
+	Providers             providers               `toml:"providers"`
+	CertificatesResolvers map[string]certResolver `toml:"certificatesResolvers,omitempty"`
+	API                   api                     `toml:"api"`
+	Log                   logConfig               `toml:"log"`
+}
+
+type entryPoint struct {
+	Address string `toml:"address"`
+}
+
+type ping struct {
+	EntryPoint string `toml:"entryPoint"`
+}
+
+type providers struct {
+	File fileProvider `toml:"file"`
+}
+
+type fileProvider struct {
+	Directory string `toml:"directory"`
+	Watch     bool   `toml:"watch"`
+}
+
+type certResolver struct {
+	ACME acmeResolver `toml:"acme"`
+}
+
+type acmeResolver struct {
+	Email         string         `toml:"email,omitempty"`
+	CAServer      string         `toml:"caServer,omitempty"`
+	Storage       string         `toml:"storage"`
+	HTTPChallenge *httpChallenge `toml:"httpChallenge,omitempty"`
+	TLSChallenge  *tlsChallenge  `toml:"tlsChallenge,omitempty"`
+}
+
+type httpChallenge struct {
+	EntryPoint string `toml:"entryPoint"`
+}
+
+// tlsChallenge has no settings; its presence selects the challenge.
+type tlsChallenge struct{}
+
+type api struct {
+	Dashboard bool `toml:"dashboard"`
+}
+
+type logConfig struct {
+	Level string `toml:"level"`
+}
+
+// RenderStaticTOML renders Traefik's static config: the entrypoints the routes
+// need, a file provider watching DynamicDir, the API, ping and log settings.
+// Traefik only reads it at startup, so it is only rewritten, and Traefik
+// restarted, when the entrypoints or these settings change.
+func RenderStaticTOML(ingresses []Ingress, opts StaticOptions) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(buildStatic(ingresses, opts)); err != nil {
+		return "", fmt.Errorf("encode static toml: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func buildStatic(ingresses []Ingress, opts StaticOptions) *staticConfig {
+	level := opts.LogLevel
+	if level == "" {
+		level = "INFO"
+	}
+	c := &staticConfig{
+		EntryPoints: make(map[string]entryPoint),
+		Providers:   providers{File: fileProvider{Directory: opts.DynamicDir, Watch: true}},
+		// The API is only reachable through a router to api@internal,
+		// which only the dashboard entrypoint gets.
+		API: api{Dashboard: opts.Dashboard != nil},
+		Log: logConfig{Level: strings.ToUpper(level)},
+	}
+
+	for _, ing := range ingresses {
+		c.EntryPoints[EntryPointName(ing)] = entryPoint{Address: EntryPointAddress(ing, opts)}
+	}
+	if opts.ACME != nil {
+		// ACME challenges are answered on the public web or websecure
+		// entrypoint, even when no route is served there.
+		challenge := Ingress{ListenPort: WebPort}
+		if opts.ACME.Challenge == ChallengeTLSALPN {
+			challenge.ListenPort = WebSecurePort
+		}
+		c.EntryPoints[EntryPointName(challenge)] = entryPoint{Address: EntryPointAddress(challenge, opts)}
+		c.CertificatesResolvers = map[string]certResolver{CertResolver: {ACME: buildACME(opts.ACME)}}
+	}
+	if opts.Dashboard != nil {
+		c.EntryPoints[DashboardEntryPoint] = entryPoint{Address: opts.Dashboard.Address}
+	}
+	if opts.PingAddress != "" {
+		c.EntryPoints[PingEntryPoint] = entryPoint{Address: opts.PingAddress}
+		c.Ping = &ping{EntryPoint: PingEntryPoint}
+	}
+	return c
+}
+
+func buildACME(acme *ACMEOptions) acmeResolver {
+	r := acmeResolver{Email: acme.Email, CAServer: acme.CAServer, Storage: acme.Storage}
+	if acme.Challenge == ChallengeTLSALPN {
+		r.TLSChallenge = &tlsChallenge{}
+	} else {
+		r.HTTPChallenge = &httpChallenge{EntryPoint: getEntryPointName(WebPort)}
+	}
+	return r
+}
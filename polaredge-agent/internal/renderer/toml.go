@@ -2,188 +2,240 @@ package renderer
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Ingress is the same structure as what client sends
 type Ingress struct {
+	Namespace   string `json:"namespace,omitempty"`
 	Host        string `json:"host"`
+	Path        string `json:"path,omitempty"`
 	ServiceName string `json:"serviceName"`
 	ServicePort int    `json:"servicePort"`
+	// Endpoints are ready pod addresses ("ip:port"). Without them traffic
+	// goes to ServiceName:ServicePort.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Labels and Annotations come from the Kubernetes Ingress object.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ListenPort is the host port the route is served on, 80 when unset.
+	// The backend keeps ServicePort. It is never taken from the client.
+	ListenPort int `json:"-"`
+	// TLS is how the route's certificate is obtained: "" for plain HTTP,
+	// TLSACME or TLSInternal. It is decided by the agent.
+	TLS string `json:"-"`
+	// CertFile and KeyFile hold the certificate of TLSInternal routes.
+	CertFile string `json:"-"`
+	KeyFile  string `json:"-"`
+	// HealthCheck probes the route's backends, nil for none. It is built by
+	// the agent from the route's annotations.
+	HealthCheck *HealthCheck `json:"-"`
+	// AllowFrom and DenyFrom restrict the client addresses (CIDRs or IPs)
+	// of the route; ProxyDepth is how many trusted proxies in front of
+	// Traefik the allowlist skips in X-Forwarded-For. Decided by the agent.
+	AllowFrom  []string `json:"-"`
+	DenyFrom   []string `json:"-"`
+	ProxyDepth int      `json:"-"`
+	// Exposure is the mode the agent decided on ("public" or "private").
+	// It is never taken from the client.
+	Exposure string `json:"-"`
+	// Source is the client or intent the route came from.
+	Source string `json:"-"`
 }
 
-// cache tracks exposure decisions per unique host:port
-var exposureCache = make(map[string]bool)
-
-// RenderTOMLFromJSON renders full TOML config from raw JSON ingress list
-func RenderTOMLFromJSON(raw []byte) (string, error) {
+// DecodeIngresses decodes a raw JSON ingress list, as sent by the client
+func DecodeIngresses(raw []byte) ([]Ingress, error) {
 	var ingresses []Ingress
 	if err := json.Unmarshal(raw, &ingresses); err != nil {
-		return "", fmt.Errorf("unmarshal ingress list: %w", err)
+		return nil, fmt.Errorf("unmarshal ingress list: %w", err)
 	}
-	return renderFromIngressList(ingresses)
+	return ingresses, nil
 }
 
-// RenderTOMLFromJSONWithPrompt prompts for exposure on high ports
-func RenderTOMLFromJSONWithPrompt(raw []byte) (string, error) {
-	var ingresses []Ingress
-	if err := json.Unmarshal(raw, &ingresses); err != nil {
-		return "", fmt.Errorf("unmarshal ingress list: %w", err)
-	}
+// Decider decides whether a route is exposed, and may adjust it (e.g. pick
+// its listen port) before it is rendered.
+type Decider func(Ingress) (Ingress, bool)
 
+// Filter returns the routes decide lets through, dropping duplicates of the
+// same host, path and port.
+func Filter(ingresses []Ingress, decide Decider) []Ingress {
 	filtered := []Ingress{}
 	seen := make(map[string]bool)
 
 	for _, ing := range ingresses {
-		key := fmt.Sprintf("%s:%d", ing.Host, ing.ServicePort)
+		key := fmt.Sprintf("%s%s:%d", ing.Host, ing.Path, ing.ServicePort)
 		if seen[key] {
 			continue
 		}
 		seen[key] = true
 
-		// Always allow low ports
-		if ing.ServicePort <= 443 {
+		if ing, ok := decide(ing); ok {
 			filtered = append(filtered, ing)
-			continue
-		}
-
-		// Use cache if available
-		if allowed, ok := exposureCache[key]; ok {
-			if allowed {
-				filtered = append(filtered, ing)
-			}
-			continue
 		}
+	}
+	return filtered
+}
 
-		// Prompt user
-		fmt.Printf("\n🚧 [POLAREDGE] New Ingress route detected: %s\n", ing.ServiceName)
-		fmt.Printf("    Host: %s\n", ing.Host)
-		fmt.Printf("    Service: %s:%d\n", ing.ServiceName, ing.ServicePort)
-		fmt.Printf("\n⚠️  This route targets port %d, which is outside typical web ranges.\n", ing.ServicePort)
-		fmt.Println("\nChoose exposure mode:")
-		fmt.Println("    [Y] Public (expose via Traefik)")
-		fmt.Println("    [P] Private (cluster-only)")
-		fmt.Println("    [N] Off (ignore, no exposure) ← default in 60s")
-		fmt.Print("\nYour choice [N/Y/P]: ")
-
-		choice := getUserChoiceWithCountdownClean(60 * time.Second)
-		choice = strings.TrimSpace(strings.ToLower(choice))
-
-		switch choice {
-		case "y":
-			// Check if port is already in use
-			if IsPortInUse(ing.ServicePort) {
-				newPort, err := FindNextFreePort(7000, 7100)
-				if err != nil {
-					fmt.Println("❌ No free ports available. Skipping this route.")
-					exposureCache[key] = false
-					continue
-				}
-
-				if PromptUserPortSwitch(ing.ServicePort, newPort) {
-					fmt.Printf("✅ Using port %d instead of %d.\n", newPort, ing.ServicePort)
-					ing.ServicePort = newPort
-				} else {
-					fmt.Println("❌ Skipping due to user decline.")
-					exposureCache[key] = false
-					continue
-				}
-			}
+// PromptExposure asks on stdin whether a route should be exposed, and how,
+// and sets ing.Exposure to "public", "private" or "off". It blocks for up to
+// 60 seconds and reports false when no answer came.
+func PromptExposure(ing Ingress) (Ingress, bool) {
+	// Prompt user
+	fmt.Printf("\n🚧 [POLAREDGE] New Ingress route detected: %s\n", ing.ServiceName)
+	fmt.Printf("    Host: %s\n", ing.Host)
+	fmt.Printf("    Service: %s:%d\n", ing.ServiceName, ing.ServicePort)
+	fmt.Printf("\n⚠️  This route targets port %d, which is outside typical web ranges.\n", ing.ServicePort)
+	fmt.Println("\nChoose exposure mode:")
+	fmt.Println("    [Y] Public (served on :80, forwarded to the service port)")
+	fmt.Println("    [P] Private (private address only)")
+	fmt.Println("    [N] Off (ignore, no exposure)")
+	fmt.Println("\nNo answer within 60s leaves the route pending.")
+	fmt.Print("\nYour choice [N/Y/P]: ")
+
+	choice, answered := getUserChoiceWithCountdownClean(60 * time.Second)
+	if !answered {
+		return ing, false
+	}
+	choice = strings.TrimSpace(strings.ToLower(choice))
 
-			filtered = append(filtered, ing)
-			exposureCache[key] = true
+	switch choice {
+	case "y":
+		ing.Exposure = "public"
+		return ing, true
 
-		case "p":
-			filtered = append(filtered, ing)
-			exposureCache[key] = true
+	case "p":
+		ing.Exposure = "private"
+		return ing, true
 
-		default:
-			exposureCache[key] = false
-		}
+	default:
+		ing.Exposure = "off"
+		return ing, true
 	}
+}
 
-	return renderFromIngressList(filtered)
+// PingEntryPoint is the entrypoint serving Traefik's /ping health endpoint.
+const PingEntryPoint = "polaredge-ping"
+
+// StaticOptions holds the agent-side settings of the static config.
+type StaticOptions struct {
+	// DynamicDir is watched by the file provider.
+	DynamicDir string
+	// PingAddress enables /ping on a dedicated entrypoint, e.g. "127.0.0.1:8082".
+	PingAddress string
+	// PublicAddress and PrivateAddress bind the entrypoints of public and
+	// private routes. Empty means all interfaces.
+	PublicAddress  string
+	PrivateAddress string
+	// LogLevel is Traefik's log level, INFO when empty.
+	LogLevel string
+	// ACME adds the certificate resolver of TLSACME routes.
+	ACME *ACMEOptions
+	// Dashboard enables Traefik's API and dashboard; it is off when nil.
+	Dashboard *DashboardOptions
 }
 
-// Internal helper for actual TOML rendering
-func renderFromIngressList(ingresses []Ingress) (string, error) {
-	var buf bytes.Buffer
+// TLSACME routes get their certificate from the ACME resolver CertResolver,
+// TLSInternal routes one issued by the agent's own CA.
+const (
+	TLSACME      = "acme"
+	TLSInternal  = "internal"
+	CertResolver = "polaredge"
+)
 
-	// 1. EntryPoints
-	buf.WriteString("[entryPoints]\n")
-	seenPorts := make(map[int]string)
-	for _, ing := range ingresses {
-		name := getEntryPointName(ing.ServicePort)
-		if _, exists := seenPorts[ing.ServicePort]; !exists {
-			seenPorts[ing.ServicePort] = name
-			buf.WriteString(fmt.Sprintf("  [entryPoints.%s]\n", name))
-			buf.WriteString(fmt.Sprintf("    address = \":%d\"\n", ing.ServicePort))
-		}
-	}
+// ACME challenge types.
+const (
+	ChallengeHTTP    = "http-01"
+	ChallengeTLSALPN = "tls-alpn-01"
+)
 
-	// 2. Routers
-	buf.WriteString("\n[http]\n  [http.routers]\n")
-	routerSet := make(map[string]string)
+// ACMEOptions configures the ACME certificate resolver.
+type ACMEOptions struct {
+	Email string
+	// CAServer is the directory URL, Let's Encrypt when empty.
+	CAServer string
+	// Storage is the file Traefik keeps accounts and certificates in.
+	Storage string
+	// Challenge is ChallengeHTTP (default) or ChallengeTLSALPN.
+	Challenge string
+}
 
-	for _, ing := range ingresses {
-		routerName := ing.ServiceName
-		rule := fmt.Sprintf("Host(`%s`)", ing.Host)
-		entryPoint := getEntryPointName(ing.ServicePort)
+// backendURLs points at the pod endpoints when known, else at the service
+func backendURLs(ing Ingress) []string {
+	if len(ing.Endpoints) == 0 {
+		return []string{fmt.Sprintf("http://%s:%d", ing.ServiceName, ing.ServicePort)}
+	}
+	urls := make([]string, 0, len(ing.Endpoints))
+	for _, ep := range ing.Endpoints {
+		urls = append(urls, "http://"+ep)
+	}
+	return urls
+}
 
-		if existingRule, ok := routerSet[routerName]; ok && existingRule == rule {
-			continue
-		}
-		routerSet[routerName] = rule
+// Standard listen ports of the web and websecure entrypoints.
+const (
+	WebPort       = 80
+	WebSecurePort = 443
+)
 
-		buf.WriteString(fmt.Sprintf("    [http.routers.%s]\n", routerName))
-		buf.WriteString(fmt.Sprintf("      rule = \"%s\"\n", rule))
-		buf.WriteString(fmt.Sprintf("      entryPoints = [\"%s\"]\n", entryPoint))
-		buf.WriteString(fmt.Sprintf("      service = \"%s\"\n", ing.ServiceName))
+// ListenPort is the host port a route is served on: its ListenPort, or the
+// web entrypoint. A pod's port never becomes a host port by itself.
+func ListenPort(ing Ingress) int {
+	if ing.ListenPort != 0 {
+		return ing.ListenPort
 	}
+	return WebPort
+}
 
-	// 3. Services
-	buf.WriteString("  [http.services]\n")
-	servers := make(map[string][]string)
-
-	for _, ing := range ingresses {
-		url := fmt.Sprintf("http://%s:%d", ing.ServiceName, ing.ServicePort)
-		key := ing.ServiceName
-
-		found := false
-		for _, existing := range servers[key] {
-			if existing == url {
-				found = true
-				break
-			}
-		}
-		if !found {
-			servers[key] = append(servers[key], url)
-		}
+// EntryPointName names the entrypoint a route is served on. Private routes
+// get their own entrypoints, bound to the private address.
+func EntryPointName(ing Ingress) string {
+	name := getEntryPointName(ListenPort(ing))
+	if ing.Exposure == "private" {
+		name = "private-" + name
 	}
+	return name
+}
 
-	for serviceName, urls := range servers {
-		buf.WriteString(fmt.Sprintf("    [http.services.%s.loadBalancer]\n", serviceName))
-		for _, url := range urls {
-			buf.WriteString(fmt.Sprintf("      [[http.services.%s.loadBalancer.servers]]\n", serviceName))
-			buf.WriteString(fmt.Sprintf("        url = \"%s\"\n", url))
-		}
+// EntryPointAddress is the address the route's entrypoint listens on.
+func EntryPointAddress(ing Ingress, opts StaticOptions) string {
+	host := opts.PublicAddress
+	if ing.Exposure == "private" {
+		host = opts.PrivateAddress
 	}
+	return net.JoinHostPort(host, strconv.Itoa(ListenPort(ing)))
+}
 
-	return buf.String(), nil
+// CheckAddresses refuses public and private addresses whose entrypoints
+// cannot bind side by side. Public and private routes share the web,
+// websecure and dedicated ports, so once private routes are served the
+// public address must be a concrete address other than the private one;
+// binding all interfaces would take the port on the private address too.
+func CheckAddresses(public, private string) error {
+	if private == "" {
+		return nil
+	}
+	switch public {
+	case "", "0.0.0.0", "::":
+		return fmt.Errorf("publicAddress must be set when private routes are served on %s: public entrypoints on all interfaces would take their ports", private)
+	case private:
+		return fmt.Errorf("publicAddress and the private address are both %s", private)
+	}
+	return nil
 }
 
 // Maps port to entryPoint name
 func getEntryPointName(port int) string {
 	switch port {
-	case 80:
+	case WebPort:
 		return "web"
-	case 443:
+	case WebSecurePort:
 		return "websecure"
 	case 22:
 		return "ssh"
@@ -194,32 +246,38 @@ func getEntryPointName(port int) string {
 	}
 }
 
-// Clean countdown + input fallback after timeout
-func getUserChoiceWithCountdownClean(timeout time.Duration) string {
-	inputCh := make(chan string, 1)
-
+// stdinLines reads stdin for every prompt. A single reader outlives timed
+// out prompts, so a late line answers the next prompt instead of being lost.
+var stdinLines = sync.OnceValue(func() <-chan string {
+	lines := make(chan string)
 	go func() {
-		reader := bufio.NewReader(os.Stdin)
-		text, _ := reader.ReadString('\n')
-		inputCh <- text
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
 	}()
+	return lines
+})
 
+// Clean countdown; reports false when the timeout passes or stdin is closed.
+func getUserChoiceWithCountdownClean(timeout time.Duration) (string, bool) {
 	start := int(timeout.Seconds())
 
 	for i := start; i > 0; i-- {
 		fmt.Printf("\r⌛ %d seconds remaining... ", i)
 		select {
-		case input := <-inputCh:
+		case input, ok := <-stdinLines():
 			fmt.Print("\r\033[K") // clear line
-			return input
+			return input, ok
 		case <-time.After(1 * time.Second):
 			continue
 		}
 	}
 
 	fmt.Print("\r\033[K") // clear line
-	fmt.Println("⏱️ No response — defaulting to [N]")
-	return "n"
+	fmt.Println("⏱️ No response — the route stays pending")
+	return "", false
 }
 
 // Port check helpers
@@ -242,13 +300,3 @@ func FindNextFreePort(start, end int) (int, error) {
 	}
 	return 0, fmt.Errorf("no free port found in range %d–%d", start, end)
 }
-
-func PromptUserPortSwitch(oldPort, newPort int) bool {
-	fmt.Printf("⚠️  Port %d is already in use.\n", oldPort)
-	fmt.Printf("Use alternative port %d? [Y/N]: ", newPort)
-
-	reader := bufio.NewReader(os.Stdin)
-	text, _ := reader.ReadString('\n')
-	input := strings.TrimSpace(strings.ToLower(text))
-	return input == "y" || input == "yes"
-}
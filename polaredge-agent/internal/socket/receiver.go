@@ -2,54 +2,110 @@ package socket
 
 import (
 	"bufio"
+	"crypto/tls"
+	"encoding/json"
 	"log"
 	"net"
-	"os"
+	"time"
+
+	"polaredge-agent/internal/auth"
+	"polaredge-agent/internal/protocol"
+	"polaredge-agent/internal/tlsutil"
 )
 
-func StartTCPReceiver() {
-	listen, err := net.Listen("tcp", "localhost:9005")
+// maxEnvelopeSize caps how much a single connection may send.
+const maxEnvelopeSize = 8 << 20
+
+// Handler is called for every envelope that passed verification.
+type Handler func(env *protocol.Envelope) protocol.Ack
+
+// Receiver accepts signed manifest envelopes over TCP, or over mutual TLS
+// when TLS is set.
+type Receiver struct {
+	Addr       string
+	Keyring    *auth.Keyring
+	Authorizer *auth.Authorizer
+	TLS        *tls.Config
+	// MaxManifestSize limits an envelope after decompression.
+	MaxManifestSize int64
+	Handle          Handler
+}
+
+// ListenAndServe binds Addr and serves connections until the listener fails.
+func (r *Receiver) ListenAndServe() error {
+	listener, err := net.Listen("tcp", r.Addr)
 	if err != nil {
-		log.Fatalf("❌ Failed to bind TCP socket: %v", err)
+		return err
+	}
+	if r.TLS != nil {
+		listener = tls.NewListener(listener, r.TLS)
+		log.Printf("📡 Agent listening on %s (mTLS)", listener.Addr())
+	} else {
+		log.Printf("📡 Agent listening on %s", listener.Addr())
 	}
-	log.Println("📡 Agent listening on TCP :9005")
 
 	for {
-		conn, err := listen.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			log.Printf("⚠️  Accept failed: %v", err)
 			continue
 		}
-
-		go handleConnection(conn)
+		go r.handleConnection(conn)
 	}
 }
 
-func handleConnection(conn net.Conn) {
+func (r *Receiver) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	data, err := bufio.NewReader(conn).ReadBytes(0)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var peer string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			log.Printf("🔒 TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+		id, err := tlsutil.PeerIdentity(tlsConn.ConnectionState())
+		if err != nil {
+			log.Printf("🔒 Rejected %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		peer = id
+	}
+
+	raw, err := protocol.ReadEnvelope(bufio.NewReader(conn), maxEnvelopeSize, r.MaxManifestSize)
 	if err != nil {
-		log.Printf("⚠️  Read failed: %v", err)
+		log.Printf("❌ Read error from %s: %v", conn.RemoteAddr(), err)
+		reply(conn, protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonMalformed, Error: "malformed envelope: " + err.Error()})
 		return
 	}
 
-	// Remove null terminator if sent
-	data = trimNullBytes(data)
-
-	// Save for inspection
-	_ = os.WriteFile("received_manifest.json", data, 0644)
-	log.Printf("✅ Received ingress data (%d bytes), saved to received_manifest.json\n", len(data))
+	env, err := protocol.Decode(raw)
+	if err != nil {
+		log.Printf("❌ Rejected envelope from %s: %v", conn.RemoteAddr(), err)
+		reply(conn, protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonMalformed, Error: err.Error()})
+		return
+	}
+	if err := r.Authorizer.Authorize(peer, env); err != nil {
+		log.Printf("🔒 Unauthorized manifest from %s: %v", conn.RemoteAddr(), err)
+		reply(conn, protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonUnauthorized, Generation: env.Generation, Error: err.Error()})
+		return
+	}
+	if err := r.Keyring.Verify(env); err != nil {
+		log.Printf("🔒 Rejected manifest from %s (client %q): %v", conn.RemoteAddr(), env.Client, err)
+		reply(conn, protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonUnauthorized, Generation: env.Generation, Error: err.Error()})
+		return
+	}
+	if err := r.Keyring.Commit(env); err != nil {
+		log.Printf("🔒 Rejected manifest from %s (client %q): %v", conn.RemoteAddr(), env.Client, err)
+		reply(conn, protocol.Ack{Status: protocol.AckRejected, Reason: protocol.ReasonUnauthorized, Generation: env.Generation, Error: err.Error()})
+		return
+	}
 
-	// Respond with ACK
-	_, _ = conn.Write([]byte("ok"))
+	reply(conn, r.Handle(env))
 }
 
-func trimNullBytes(data []byte) []byte {
-	for i, b := range data {
-		if b == 0 {
-			return data[:i]
-		}
-	}
-	return data
+func reply(conn net.Conn, ack protocol.Ack) {
+	conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	_ = json.NewEncoder(conn).Encode(ack)
 }
@@ -0,0 +1,136 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// checkInterval limits how often the files are stat'ed during handshakes.
+const checkInterval = 5 * time.Second
+
+// Reloader serves a server certificate and client CA pool from files and
+// picks up replaced files without restarting the agent.
+type Reloader struct {
+	caFile, certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewReloader loads the files once and fails if they are unusable.
+func NewReloader(caFile, certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{caFile: caFile, certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ServerConfig returns a TLS config that requires and verifies client certificates.
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}, nil
+		},
+	}
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	due := time.Since(r.lastCheck) >= checkInterval
+	r.mu.Unlock()
+
+	if due {
+		if err := r.load(); err != nil {
+			log.Printf("⚠️  TLS reload failed, keeping previous certificate: %v", err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.pool
+}
+
+func (r *Reloader) load() error {
+	latest, err := latestModTime(r.caFile, r.certFile, r.keyFile)
+
+	r.mu.Lock()
+	r.lastCheck = time.Now()
+	unchanged := err == nil && r.cert != nil && !latest.After(r.modTime)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(r.caFile)
+	if err != nil {
+		return fmt.Errorf("read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return errors.New("CA file contains no certificates")
+	}
+
+	r.mu.Lock()
+	reloaded := r.cert != nil
+	r.cert, r.pool, r.modTime = &cert, pool, latest
+	r.mu.Unlock()
+
+	if reloaded {
+		log.Println("🔐 TLS certificate and CA reloaded")
+	}
+	return nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// PeerIdentity returns the client identity from a verified certificate: the
+// first URI SAN (e.g. a SPIFFE ID), else the first DNS SAN.
+func PeerIdentity(state tls.ConnectionState) (string, error) {
+	if len(state.PeerCertificates) == 0 {
+		return "", errors.New("no client certificate")
+	}
+	leaf := state.PeerCertificates[0]
+	if len(leaf.URIs) > 0 {
+		return leaf.URIs[0].String(), nil
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0], nil
+	}
+	return "", errors.New("client certificate has no URI or DNS SAN")
+}
@@ -0,0 +1,74 @@
+package traefik
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// configErrorMessages are the messages of the error lines Traefik logs when
+// it cannot use the config we wrote: the file provider failing to load it, or
+// an entrypoint failing to bind. Lines that merely name an entrypoint, such
+// as a failed client connection, are runtime noise.
+var configErrorMessages = []string{
+	"error while building configuration",
+	"cannot start the provider",
+	"error while building entrypoint",
+	"error opening listener",
+	"address already in use",
+}
+
+// fileRouter matches the router field of lines about a router from our file
+// provider, e.g. a rule Traefik cannot parse.
+var fileRouter = regexp.MustCompile(`routername="?[^\s"]+@file(\s|"|$)`)
+
+// isErrorLine reports whether a Traefik log line is an error, in either the
+// logfmt ("level=error") or the v3 console ("ERR") format.
+func isErrorLine(line string) bool {
+	return strings.Contains(line, "level=error") || strings.Contains(line, "level=fatal") ||
+		strings.Contains(line, " ERR ") || strings.Contains(line, " FTL ")
+}
+
+// IsConfigError reports whether a log line is an error caused by the routing
+// config: an error level line from the file provider, about one of its
+// routers, or with one of configErrorMessages.
+func IsConfigError(line string) bool {
+	if !isErrorLine(line) {
+		return false
+	}
+	lower := strings.ToLower(line)
+	if strings.Contains(lower, "providername=file") || fileRouter.MatchString(lower) {
+		return true
+	}
+	for _, msg := range configErrorMessages {
+		if strings.Contains(lower, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitHealthy polls Traefik's ping endpoint until it answers 200 OK.
+func WaitHealthy(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: 2 * time.Second}
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("ping returned %s", resp.Status)
+		}
+		lastErr = err
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("traefik not healthy after %s: %w", timeout, lastErr)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
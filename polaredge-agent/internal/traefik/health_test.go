@@ -0,0 +1,32 @@
+package traefik
+
+import "testing"
+
+func TestIsConfigError(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		// File provider and router errors, in the v3 console and logfmt formats.
+		{`2024-06-01T10:00:00Z ERR Error while building configuration (for the first time) error="toml: line 3" providerName=file`, true},
+		{`time="2024-06-01T10:00:00Z" level=error msg="Cannot start the provider *file.Provider" providerName=file`, true},
+		{`2024-06-01T10:00:00Z ERR error="invalid rule Host(" entryPointName=web routerName=c1-shop-web-80@file`, true},
+		{`2024-06-01T10:00:00Z ERR Error while building entryPoint error="error opening listener: listen tcp :8080: bind: address already in use" entryPointName=port8080`, true},
+		{`time="2024-06-01T10:00:00Z" level=fatal msg="Error while starting server: listen tcp :80: bind: address already in use"`, true},
+
+		// Runtime errors that merely name an entrypoint, and routers of other
+		// providers.
+		{`2024-06-01T10:00:00Z ERR Error while handling TCP connection error="readfrom tcp: broken pipe" entryPointName=websecure`, false},
+		{`time="2024-06-01T10:00:00Z" level=error msg="Unable to obtain ACME certificate for domains" routerName=api@internal entryPointName=websecure`, false},
+		{`2024-06-01T10:00:00Z ERR error="invalid rule" entryPointName=web routerName=c1-shop-web-80@kubernetescrd`, false},
+
+		// Not errors at all.
+		{`2024-06-01T10:00:00Z INF Starting provider *file.Provider providerName=file`, false},
+		{`2024-06-01T10:00:00Z WRN Health check failed. error="dial tcp: connection refused" entryPointName=web`, false},
+	}
+	for _, tt := range tests {
+		if got := IsConfigError(tt.line); got != tt.want {
+			t.Errorf("IsConfigError(%q) = %t, want %t", tt.line, got, tt.want)
+		}
+	}
+}
@@ -158,38 +158,6 @@ func GetBinaryPath() string {
 	return binPath
 }
 
-func RunWithConfig(configPath string) error {
-	cmd := exec.Command(GetBinaryPath(), "--configFile", configPath)
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("stdout pipe error: %w", err)
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("stderr pipe error: %w", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("❌ Traefik failed to start: %w", err)
-	}
-
-	// Stream logs live
-	go streamTaggedLogs(stdout, "[TRAEFIK]")
-	go streamTaggedLogs(stderr, "[TRAEFIK][ERR]")
-
-	// Wait for process to finish in background
-	go func() {
-		if err := cmd.Wait(); err != nil {
-			fmt.Printf("❌ Traefik exited with error: %s\n", err)
-		} else {
-			fmt.Println("🛑 Traefik exited cleanly.")
-		}
-	}()
-
-	return nil
-}
-
 func streamTaggedLogs(r io.ReadCloser, tag string) {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
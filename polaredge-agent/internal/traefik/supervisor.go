@@ -0,0 +1,202 @@
+package traefik
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = 30 * time.Second
+	// stableAfter resets the crash backoff once Traefik has run this long.
+	stableAfter = time.Minute
+	stopTimeout = 10 * time.Second
+	// maxErrorLines bounds the error lines kept for ConfigErrorsSince.
+	maxErrorLines = 200
+)
+
+type logLine struct {
+	at   time.Time
+	text string
+}
+
+// Supervisor owns the single Traefik process. Routing changes reach Traefik
+// through its file provider; the process is only restarted when the static
+// config changes, when it crashes (with backoff), or never after Stop.
+type Supervisor struct {
+	binary       string
+	staticConfig string
+	// Env is added to Traefik's environment, e.g. LEGO_CA_CERTIFICATES.
+	Env []string
+
+	once     sync.Once
+	stopOnce sync.Once
+	restart  chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu     sync.Mutex
+	errors []logLine
+}
+
+// NewSupervisor prepares a supervisor for binary with the given static config.
+func NewSupervisor(binary, staticConfig string) *Supervisor {
+	return &Supervisor{
+		binary:       binary,
+		staticConfig: staticConfig,
+		restart:      make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start launches Traefik. Calling it again has no effect.
+func (s *Supervisor) Start() {
+	s.once.Do(func() { go s.run() })
+}
+
+// Restart replaces the running Traefik, e.g. after the static config changed.
+// It starts Traefik if it was not running yet.
+func (s *Supervisor) Restart() {
+	select {
+	case s.restart <- struct{}{}:
+	default:
+	}
+	s.Start()
+}
+
+// Stop terminates Traefik and waits for it to exit.
+func (s *Supervisor) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		// Nothing to wait for if Traefik was never started.
+		s.once.Do(func() { close(s.done) })
+		<-s.done
+	})
+}
+
+func (s *Supervisor) run() {
+	defer close(s.done)
+
+	delay := minRestartDelay
+	for {
+		// A restart request that raced with startup is already satisfied.
+		select {
+		case <-s.restart:
+		default:
+		}
+
+		log.Println("🔁 Starting Traefik...")
+		cmd, exited, err := s.spawn()
+		if err != nil {
+			log.Printf("❌ Traefik failed to start: %v", err)
+		} else {
+			started := time.Now()
+			select {
+			case err := <-exited:
+				if time.Since(started) >= stableAfter {
+					delay = minRestartDelay
+				}
+				log.Printf("❌ Traefik exited unexpectedly (%v), restarting in %s", err, delay)
+			case <-s.restart:
+				log.Println("🔁 Restarting Traefik for a new static config...")
+				terminate(cmd, exited)
+				delay = minRestartDelay
+				continue
+			case <-s.stop:
+				terminate(cmd, exited)
+				log.Println("🛑 Traefik stopped.")
+				return
+			}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-s.restart:
+		case <-s.stop:
+			return
+		}
+		if delay *= 2; delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+func (s *Supervisor) spawn() (*exec.Cmd, <-chan error, error) {
+	cmd := exec.Command(s.binary, "--configFile", s.staticConfig)
+	if len(s.Env) > 0 {
+		cmd.Env = append(os.Environ(), s.Env...)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	// Stream logs live
+	go s.streamLogs(stdout, "[TRAEFIK]")
+	go s.streamLogs(stderr, "[TRAEFIK][ERR]")
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	return cmd, exited, nil
+}
+
+// terminate asks Traefik to shut down gracefully and kills it if it lingers.
+func terminate(cmd *exec.Cmd, exited <-chan error) {
+	_ = cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		log.Println("⚠️  Traefik did not stop in time, killing it.")
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// streamLogs prints Traefik's output and remembers its error lines.
+func (s *Supervisor) streamLogs(r io.ReadCloser, tag string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Printf("%s %s\n", tag, line)
+		if !isErrorLine(line) {
+			continue
+		}
+
+		s.mu.Lock()
+		s.errors = append(s.errors, logLine{at: time.Now(), text: line})
+		if len(s.errors) > maxErrorLines {
+			s.errors = s.errors[len(s.errors)-maxErrorLines:]
+		}
+		s.mu.Unlock()
+	}
+}
+
+// ConfigErrorsSince returns the config-related error lines Traefik logged
+// after t.
+func (s *Supervisor) ConfigErrorsSince(t time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, l := range s.errors {
+		if l.at.After(t) && IsConfigError(l.text) {
+			out = append(out, l.text)
+		}
+	}
+	return out
+}
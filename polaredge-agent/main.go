@@ -1,96 +1,236 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"polaredge-agent/internal/api"
+	"polaredge-agent/internal/auth"
+	"polaredge-agent/internal/ca"
+	"polaredge-agent/internal/config"
+	"polaredge-agent/internal/manager"
+	"polaredge-agent/internal/policy"
 	"polaredge-agent/internal/renderer"
+	"polaredge-agent/internal/socket"
+	"polaredge-agent/internal/tlsutil"
 	"polaredge-agent/internal/traefik"
-	"sync"
+	"strconv"
+	"syscall"
 	"time"
 )
 
+// Dedicated listen ports are allocated from this range.
 const (
-	configPath = "/tmp/polaredge.toml"
-	portMin    = 7000
-	portMax    = 7100
-	socketPort = ":9005"
+	portMin = 7000
+	portMax = 7100
 )
 
-var (
-	queue      = make(chan []byte, 100)
-	processing sync.Mutex
-)
-
-func getFreePortInRange(min, max int) (int, error) {
-	for port := min; port <= max; port++ {
-		addr := fmt.Sprintf(":%d", port)
-		ln, err := net.Listen("tcp", addr)
-		if err == nil {
-			_ = ln.Close()
-			return port, nil
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			os.Exit(runRender(os.Args[2:]))
+		case "history":
+			os.Exit(runHistory(os.Args[2:]))
+		case "exposure":
+			os.Exit(runExposure(os.Args[2:]))
+		case "pending":
+			os.Exit(runPending(os.Args[2:]))
+		case "status":
+			os.Exit(runStatus(os.Args[2:]))
 		}
 	}
-	return 0, fmt.Errorf("no free port found in range %d–%d", min, max)
-}
 
-func handle(conn net.Conn) {
-	defer conn.Close()
+	configFile := flag.String("config", config.DefaultPath, "path to the agent config file")
+	flag.Parse()
+
+	log.Println("🚀 POLAREDGE Agent starting...")
 
-	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	buf := make([]byte, 65536)
-	n, err := conn.Read(buf)
+	cfg, err := config.Load(*configFile)
 	if err != nil {
-		log.Printf("❌ Read error: %v", err)
-		return
+		log.Fatalf("❌ %v", err)
+	}
+	keyring, err := auth.NewKeyring(cfg.Keys, cfg.MaxClockSkew.Duration)
+	if err != nil {
+		log.Fatalf("❌ Refusing to start without manifest verification: %v", err)
+	}
+	authorizer := auth.NewAuthorizer(cfg.Clients)
+	socketAddr, err := cfg.SocketAddr()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
-	data := buf[:n]
 
-	// Confirm receipt to client immediately
-	_, _ = conn.Write([]byte("ok"))
+	exposure, err := policy.Load(cfg.ExposurePolicy)
+	if err != nil {
+		log.Fatalf("❌ Exposure policy: %v", err)
+	}
+	decisions, err := policy.OpenDecisions(filepath.Join(cfg.StateDir, "exposure-decisions.json"))
+	if err != nil {
+		log.Fatalf("❌ Exposure decisions: %v", err)
+	}
 
-	// Queue for background processing
-	queue <- data
-}
+	privateAddr, err := cfg.PrivateHost()
+	if err != nil {
+		log.Fatalf("❌ Private address: %v", err)
+	}
+	if privateAddr == "" {
+		log.Println("⚠️  No private address configured, private routes will not be served")
+	}
+	if err := renderer.CheckAddresses(cfg.PublicAddress, privateAddr); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
 
-func processManifest(data []byte) {
-	defer processing.Unlock()
+	supervisor := traefik.NewSupervisor(traefik.GetBinaryPath(), filepath.Join(cfg.TraefikDir, "traefik.toml"))
 
-	toml, err := renderer.RenderTOMLFromJSONWithPrompt(data)
-	if err != nil {
-		log.Printf("❌ Failed to render TOML: %v", err)
-		return
+	var acme *renderer.ACMEOptions
+	if cfg.ACME != nil {
+		acme = &renderer.ACMEOptions{
+			Email:     cfg.ACME.Email,
+			CAServer:  cfg.ACME.CAServer,
+			Storage:   cfg.ACME.Storage,
+			Challenge: cfg.ACME.Challenge,
+		}
+		if acme.Storage == "" {
+			acme.Storage = filepath.Join(cfg.StateDir, "acme.json")
+		}
+		switch acme.Challenge {
+		case "":
+			acme.Challenge = renderer.ChallengeHTTP
+		case renderer.ChallengeHTTP, renderer.ChallengeTLSALPN:
+		default:
+			log.Fatalf("❌ ACME challenge must be %s or %s, not %q", renderer.ChallengeHTTP, renderer.ChallengeTLSALPN, acme.Challenge)
+		}
+		if cfg.ACME.CACertificates != "" {
+			supervisor.Env = append(supervisor.Env, "LEGO_CA_CERTIFICATES="+cfg.ACME.CACertificates)
+		}
+		ca := acme.CAServer
+		if ca == "" {
+			ca = "Let's Encrypt"
+		}
+		log.Printf("🔐 ACME certificates from %s (%s)", ca, acme.Challenge)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
-		log.Printf("mkdir error: %v", err)
-		return
+	var authority *ca.Authority
+	if cfg.InternalCA != nil {
+		dir := cfg.InternalCA.Dir
+		if dir == "" {
+			dir = filepath.Join(cfg.StateDir, "ca")
+		}
+		validity := cfg.InternalCA.LeafValidity.Duration
+		if validity == 0 {
+			validity = 30 * 24 * time.Hour
+		}
+		if authority, err = ca.Open(dir, validity); err != nil {
+			log.Fatalf("❌ Internal CA: %v", err)
+		}
 	}
-	if err := os.WriteFile(configPath, []byte(toml), 0644); err != nil {
-		log.Printf("file write error: %v", err)
-		return
+
+	var dashboard *renderer.DashboardOptions
+	if d := cfg.Dashboard; d != nil {
+		if privateAddr == "" {
+			log.Fatalf("❌ The dashboard is only served on the private address, and none is configured")
+		}
+		if len(d.Users) == 0 && d.UsersFile == "" && len(d.AllowFrom) == 0 {
+			log.Fatalf("❌ The dashboard needs users, usersFile or allowFrom")
+		}
+		allow, err := policy.ParseCIDRs(d.AllowFrom)
+		if err != nil {
+			log.Fatalf("❌ Dashboard allowFrom: %v", err)
+		}
+		port := d.Port
+		if port == 0 {
+			port = 8080
+		}
+		if port < 1 || port > 65535 {
+			log.Fatalf("❌ Dashboard port %d is out of range", port)
+		}
+		dashboard = &renderer.DashboardOptions{
+			Address:   net.JoinHostPort(privateAddr, strconv.Itoa(port)),
+			Users:     d.Users,
+			UsersFile: d.UsersFile,
+			AllowFrom: allow,
+		}
+		log.Printf("📊 Traefik dashboard on http://%s/dashboard/", dashboard.Address)
 	}
-	log.Printf("✅ TOML written to %s", configPath)
 
-	log.Println("🔁 Starting Traefik with new config...")
-	if err := traefik.RunWithConfig(configPath); err != nil {
-		log.Printf("❌ Traefik reload failed: %v", err)
-	} else {
-		log.Println("🚀 Traefik exited cleanly.")
+	allowed, err := listenPorts(cfg)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
-}
+	for port := portMin; port <= portMax; port++ {
+		if !policy.InPortRanges(allowed, port) {
+			log.Printf("⚠️  Dedicated listen port %d is outside listenPorts, routes given it will be rejected", port)
+			break
+		}
+	}
+
+	mgr, err := manager.New(manager.Options{
+		TraefikDir: cfg.TraefikDir,
+		StateDir:   cfg.StateDir,
+		AckTimeout: cfg.AckTimeout.Duration,
+		Supervisor: supervisor,
+
+		DynamicDir:    cfg.DynamicDir,
+		DynamicFormat: cfg.DynamicFormat,
+
+		PingPort:      cfg.PingPort,
+		ReloadSettle:  cfg.ReloadSettle.Duration,
+		HealthTimeout: cfg.HealthTimeout.Duration,
+		LogLevel:      cfg.TraefikLogLevel,
+		HistorySize:   cfg.HistorySize,
+		Policy:        exposure,
+		Interactive:   cfg.InteractiveExposure,
+		Decisions:     decisions,
+
+		PublicAddress:  cfg.PublicAddress,
+		PrivateAddress: privateAddr,
+		PortMin:        portMin,
+		PortMax:        portMax,
 
-func queueWorker() {
-	for data := range queue {
-		processing.Lock()
-		processManifest(data)
+		ACME:        acme,
+		ACMEDefault: cfg.ACME != nil && cfg.ACME.Default,
+		CA:          authority,
+		CADefault:   cfg.InternalCA != nil && cfg.InternalCA.Default,
+
+		BackendHealth: backendHealth(cfg.BackendHealthCheck),
+		ProxyDepth:    cfg.TrustedProxyDepth,
+		Dashboard:     dashboard,
+		ReservedPorts: reservedPorts(cfg),
+		ListenPorts:   allowed,
+	})
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
-}
 
-func main() {
-	log.Println("🚀 POLAREDGE Agent starting...")
+	receiver := &socket.Receiver{
+		Addr:       socketAddr,
+		Keyring:    keyring,
+		Authorizer: authorizer,
+		Handle:     mgr.Submit,
+
+		MaxManifestSize: cfg.MaxManifestBytes,
+	}
+	apiServer := &api.Server{
+		Manager:    mgr,
+		Keyring:    keyring,
+		Authorizer: authorizer,
+
+		MaxManifestSize: cfg.MaxManifestBytes,
+		AckTimeout:      cfg.AckTimeout.Duration,
+	}
+	if cfg.TLS != nil {
+		reloader, err := tlsutil.NewReloader(cfg.TLS.CAFile, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			log.Fatalf("❌ TLS setup failed: %v", err)
+		}
+		receiver.TLS = reloader.ServerConfig()
+		apiServer.TLS = reloader.ServerConfig()
+	}
 
 	if !traefik.IsInstalled() {
 		fmt.Println("⚠️  Traefik not found.")
@@ -106,26 +246,78 @@ func main() {
 		return
 	}
 
-	port, err := getFreePortInRange(portMin, portMax)
-	if err != nil {
-		log.Fatalf("❌ No free port found: %v", err)
+	// Take Traefik down with the agent
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("👋 %s received, shutting down...", sig)
+		supervisor.Stop()
+		os.Exit(0)
+	}()
+
+	mgr.Start()
+	go mgr.Run()
+
+	if cfg.ControlSocket != "" {
+		go func() {
+			if err := apiServer.ServeControl(cfg.ControlSocket); err != nil {
+				log.Printf("❌ Control socket stopped: %v", err)
+			}
+		}()
 	}
-	fmt.Printf("✅ Free port selected: %d\n", port)
 
-	listener, err := net.Listen("tcp", socketPort)
-	if err != nil {
+	if cfg.APIPort != 0 {
+		if apiServer.Addr, err = cfg.APIAddr(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		go func() {
+			if err := apiServer.ListenAndServe(); err != nil {
+				log.Fatalf("HTTP API error: %v", err)
+			}
+		}()
+	}
+
+	if err := receiver.ListenAndServe(); err != nil {
 		log.Fatalf("listen error: %v", err)
 	}
-	log.Printf("📡 Agent listening on %s", socketPort)
+}
 
-	go queueWorker()
+// reservedPorts are the host ports routes may not listen on: ssh and the
+// agent's own listeners.
+func reservedPorts(cfg *config.Config) []int {
+	ports := []int{22, cfg.SocketPort}
+	if cfg.APIPort != 0 {
+		ports = append(ports, cfg.APIPort)
+	}
+	return ports
+}
 
-	for {
-		conn, err := listener.Accept()
+// listenPorts parses the host ports routes may listen on.
+func listenPorts(cfg *config.Config) ([]policy.PortRange, error) {
+	if len(cfg.ListenPorts) == 0 {
+		return nil, errors.New("listenPorts is empty, no route could be served")
+	}
+	ranges := make([]policy.PortRange, 0, len(cfg.ListenPorts))
+	for _, spec := range cfg.ListenPorts {
+		r, err := policy.ParsePortRange(spec)
 		if err != nil {
-			log.Printf("accept error: %v", err)
-			continue
+			return nil, fmt.Errorf("listenPorts: %w", err)
 		}
-		go handle(conn)
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// backendHealth turns the configured health check defaults into the form
+// routes are rendered with.
+func backendHealth(c config.HealthCheckConfig) renderer.HealthCheck {
+	hc := renderer.HealthCheck{Path: c.Path, Scheme: c.Scheme, Status: c.Status}
+	if c.Interval.Duration > 0 {
+		hc.Interval = c.Interval.String()
+	}
+	if c.Timeout.Duration > 0 {
+		hc.Timeout = c.Timeout.String()
 	}
+	return hc
 }
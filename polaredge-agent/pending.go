@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"polaredge-agent/internal/manager"
+	"polaredge-agent/internal/policy"
+)
+
+const pendingUsage = `usage: polaredge-agent pending [-config file] <command>
+
+  list                        routes waiting for approval
+  approve <host:port>         expose the route
+      [-private] [-port N] [-by name] [-note text]
+  deny <host:port>            keep the route off
+      [-by name] [-note text]
+`
+
+// runPending implements `polaredge-agent pending`, resolving routes the
+// exposure policy holds back until an operator decides.
+func runPending(args []string) int {
+	fs := flag.NewFlagSet("pending", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, pendingUsage) }
+	ctl, rest, err := newControlClient(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if len(rest) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	switch cmd := rest[0]; {
+	case cmd == "list" && len(rest) == 1:
+		err = pendingList(ctl)
+	case (cmd == "approve" || cmd == "deny") && len(rest) >= 2:
+		err = pendingResolve(ctl, cmd, rest[1], rest[2:])
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func pendingList(ctl *controlClient) error {
+	var pending []manager.PendingRoute
+	if err := ctl.do(http.MethodGet, "/v1/pending", nil, &pending); err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Println("✅ No routes waiting for approval.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTE\tSERVICE\tPATHS\tFROM\tWAITING")
+	for _, p := range pending {
+		service := p.ServiceName
+		if p.Namespace != "" {
+			service = p.Namespace + "/" + service
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Key(), service, strings.Join(p.Paths, ","), strings.Join(p.Sources, ","), time.Since(p.Since).Round(time.Second))
+	}
+	return tw.Flush()
+}
+
+func pendingResolve(ctl *controlClient, action, route string, args []string) error {
+	fs := flag.NewFlagSet("pending "+action, flag.ContinueOnError)
+	private := fs.Bool("private", false, "expose on the private address only")
+	port := fs.Int("port", 0, "serve the route on this host port instead of :80")
+	by := fs.String("by", operatorName(), "who made the decision")
+	note := fs.String("note", "", "free-form note, e.g. a ticket")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rec := policy.Record{Mode: policy.Public, ExposePort: *port, DecidedBy: *by, Note: *note}
+	if *private {
+		rec.Mode = policy.Private
+	}
+	if err := ctl.do(http.MethodPost, "/v1/pending/"+url.PathEscape(route)+"/"+action, rec, nil); err != nil {
+		return err
+	}
+	if action == "deny" {
+		fmt.Printf("🚫 %s denied, it stays off.\n", route)
+	} else {
+		fmt.Printf("✅ %s approved as %s.\n", route, rec.Mode)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"polaredge-agent/internal/fsutil"
+	"polaredge-agent/internal/renderer"
+)
+
+// runRender implements `polaredge-agent render [-f manifest.json]`: it prints
+// the Traefik config for a manifest without prompting or starting anything.
+// Static and dynamic config are rendered separately, as the agent writes them.
+func runRender(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	file := fs.String("f", "-", "manifest JSON to render, - for stdin")
+	traefikDir := fs.String("traefik-dir", "/etc/traefik", "Traefik directory the static config points at")
+	format := fs.String("format", renderer.FormatTOML, "dynamic config format: toml or yaml")
+	out := fs.String("o", "", "write traefik.toml and dynamic/polaredge.<format> to this directory instead of printing them")
+	fs.Parse(args)
+
+	var (
+		raw []byte
+		err error
+	)
+	if *file == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ read manifest: %v\n", err)
+		return 1
+	}
+
+	ingresses, err := renderer.DecodeIngresses(raw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	static, err := renderer.RenderStaticTOML(ingresses, renderer.StaticOptions{DynamicDir: filepath.Join(*traefikDir, "dynamic")})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	dynamic, err := renderer.RenderDynamic(ingresses, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	dynamicFile := "dynamic/polaredge." + *format
+
+	if *out == "" {
+		fmt.Printf("# traefik.toml (static, passed as --configFile)\n%s\n", static)
+		fmt.Printf("# %s (file provider)\n%s", dynamicFile, dynamic)
+		return 0
+	}
+	if err := os.MkdirAll(filepath.Join(*out, "dynamic"), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	for name, data := range map[string]string{"traefik.toml": static, dynamicFile: dynamic} {
+		if err := fsutil.WriteFileAtomic(filepath.Join(*out, name), []byte(data), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+	}
+	fmt.Printf("✅ Wrote %s and %s\n", filepath.Join(*out, "traefik.toml"), filepath.Join(*out, dynamicFile))
+	return 0
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"polaredge-agent/internal/manager"
+)
+
+// runStatus implements `polaredge-agent status`: what the running agent
+// serves, where, and what is waiting.
+func runStatus(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	ctl, _, err := newControlClient(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	var st manager.State
+	if err := ctl.do(http.MethodGet, "/v1/state", nil, &st); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	switch {
+	case st.LastApply == nil:
+		fmt.Println("Last apply:  never")
+	default:
+		fmt.Printf("Last apply:  %s (%s ago)\n", st.LastApply.Local().Format(time.DateTime), time.Since(*st.LastApply).Round(time.Second))
+	}
+	if st.ConfigHash != "" {
+		fmt.Printf("Config:      %s\n", st.ConfigHash)
+	}
+	if st.LastError != "" {
+		fmt.Printf("Last error:  %s\n", st.LastError)
+	}
+	if st.Dashboard != "" {
+		fmt.Printf("Dashboard:   %s\n", st.Dashboard)
+	}
+	if st.PinnedRevision != 0 {
+		fmt.Printf("Pinned:      revision %d (polaredge-agent history unpin)\n", st.PinnedRevision)
+	}
+	for _, src := range st.Sources {
+		fmt.Printf("Client:      %s generation %d, applied %d\n", src.Client, src.Generation, src.AppliedGeneration)
+	}
+
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTE\tEXPOSURE\tLISTENS ON\tTLS\tSERVICE\tSOURCE")
+	private := 0
+	for _, r := range st.Routes {
+		route := r.Host + r.Path
+		exposure := r.Exposure
+		if exposure == "private" {
+			private++
+			exposure = "🔒 private"
+		}
+		service := fmt.Sprintf("%s:%d", r.ServiceName, r.BackendPort)
+		if r.Namespace != "" {
+			service = r.Namespace + "/" + service
+		}
+		tls := r.TLS
+		if tls == "" {
+			tls = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", route, exposure, r.Address, tls, service, r.Source)
+	}
+	tw.Flush()
+	fmt.Printf("\n%d route(s), %d private.\n", len(st.Routes), private)
+	if len(st.Pending) > 0 {
+		fmt.Printf("⏸️  %d route(s) waiting for approval: polaredge-agent pending list\n", len(st.Pending))
+	}
+	if len(st.Rejected) > 0 {
+		fmt.Printf("\n⛔ %d route(s) rejected:\n", len(st.Rejected))
+		for _, r := range st.Rejected {
+			fmt.Printf("   %s (from %s)\n", r, r.Source)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"polaredge-client/internal/diff"
+	"polaredge-client/internal/sender"
+	"polaredge-client/internal/watcher"
+	"strings"
+	"time"
+)
+
+// appliedSource is the agent's view of this client, from GET /v1/manifests?client=.
+type appliedSource struct {
+	Generation        int64           `json:"generation"`
+	AppliedGeneration int64           `json:"appliedGeneration"`
+	AppliedManifest   json.RawMessage `json:"appliedManifest"`
+	Error             string          `json:"error"`
+}
+
+// runDiff implements `polaredge-client diff`: it compares the manifest the
+// agent has applied with what the cluster (or -f dir/) resolves to right now.
+// Exit codes: 0 in sync, 1 drift, 2 error.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	apiURL := fs.String("api", "http://10.88.0.1:9000", "agent HTTP API base URL")
+	client := fs.String("client-id", defaultClientID(), "client identity whose manifest to compare (defaults to the -tls-cert SAN)")
+	dir := fs.String("f", "", "compare against YAML files in this directory instead of the cluster")
+	caFile := fs.String("tls-ca", "", "CA bundle for an https API")
+	certFile := fs.String("tls-cert", "", "client certificate for an https API")
+	keyFile := fs.String("tls-key", "", "client certificate key")
+	fs.Parse(args)
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	if *caFile != "" {
+		files := &sender.TLSFiles{CAFile: *caFile, CertFile: *certFile, KeyFile: *keyFile}
+		cfg, err := files.Config()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ TLS setup failed: %v\n", err)
+			return 2
+		}
+		httpClient.Transport = &http.Transport{TLSClientConfig: cfg}
+		if !flagSet(fs, "client-id") && *certFile != "" {
+			if *client, err = files.Identity(); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+				return 2
+			}
+		}
+	}
+
+	src, err := fetchApplied(httpClient, *apiURL, *client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	var applied []watcher.Ingress
+	if len(src.AppliedManifest) > 0 {
+		if err := json.Unmarshal(src.AppliedManifest, &applied); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ decode applied manifest: %v\n", err)
+			return 2
+		}
+	}
+
+	desired, err := desiredRoutes(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	fmt.Printf("Agent generation: applied %d, received %d\n", src.AppliedGeneration, src.Generation)
+	if src.Error != "" {
+		fmt.Printf("Last apply error: %s\n", src.Error)
+	}
+
+	changes := diff.Routes(applied, desired)
+	if len(changes) == 0 {
+		fmt.Printf("✅ In sync (%d routes)\n", len(desired))
+		return 0
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	fmt.Printf("⚠️  Drift: %d route(s) differ\n", len(changes))
+	return 1
+}
+
+// desiredRoutes resolves the routes from dir, or from the cluster when dir is
+// empty. A failed read is an error, never an empty route set, so it cannot be
+// reported as every route removed.
+func desiredRoutes(dir string) ([]watcher.Ingress, error) {
+	if dir == "" {
+		return watcher.GetIngresses()
+	}
+	objs, err := watcher.LoadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return watcher.Resolve(objs.Ingresses, objs.Services, objs.EndpointSlices), nil
+}
+
+func fetchApplied(c *http.Client, base, client string) (*appliedSource, error) {
+	endpoint := strings.TrimRight(base, "/") + "/v1/manifests?client=" + url.QueryEscape(client)
+	resp, err := c.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("query agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		// The agent has never heard from this client: everything is drift.
+		return &appliedSource{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("agent returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var src appliedSource
+	if err := json.NewDecoder(resp.Body).Decode(&src); err != nil {
+		return nil, fmt.Errorf("decode agent response: %w", err)
+	}
+	return &src, nil
+}
@@ -0,0 +1,99 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"polaredge-client/internal/watcher"
+)
+
+// Kind of change between the applied and the desired route set.
+const (
+	Added   = "+"
+	Removed = "-"
+	Changed = "~"
+)
+
+// Change is one route that differs between two manifests.
+type Change struct {
+	Kind    string
+	Key     string
+	Route   watcher.Ingress
+	Details []string
+}
+
+func (c Change) String() string {
+	line := fmt.Sprintf("%s %s", c.Kind, c.Route)
+	if len(c.Details) > 0 {
+		line += " (" + strings.Join(c.Details, "; ") + ")"
+	}
+	return line
+}
+
+// Routes compares the routes the agent applied with the desired ones. Routes
+// are matched by namespace, host and path.
+func Routes(applied, desired []watcher.Ingress) []Change {
+	have := index(applied)
+	want := index(desired)
+
+	var changes []Change
+	for key, w := range want {
+		h, ok := have[key]
+		if !ok {
+			changes = append(changes, Change{Kind: Added, Key: key, Route: w})
+			continue
+		}
+		if details := compare(h, w); len(details) > 0 {
+			changes = append(changes, Change{Kind: Changed, Key: key, Route: w, Details: details})
+		}
+	}
+	for key, h := range have {
+		if _, ok := want[key]; !ok {
+			changes = append(changes, Change{Kind: Removed, Key: key, Route: h})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+func index(routes []watcher.Ingress) map[string]watcher.Ingress {
+	out := make(map[string]watcher.Ingress, len(routes))
+	for _, r := range routes {
+		out[r.Namespace+"/"+r.Host+r.Path] = r
+	}
+	return out
+}
+
+func compare(have, want watcher.Ingress) []string {
+	var details []string
+	if have.ServiceName != want.ServiceName {
+		details = append(details, fmt.Sprintf("service %s → %s", have.ServiceName, want.ServiceName))
+	}
+	if have.ServicePort != want.ServicePort {
+		details = append(details, fmt.Sprintf("port %d → %d", have.ServicePort, want.ServicePort))
+	}
+	if h, w := strings.Join(have.Endpoints, ","), strings.Join(want.Endpoints, ","); h != w {
+		details = append(details, fmt.Sprintf("endpoints [%s] → [%s]", h, w))
+	}
+	if !sameMap(have.Labels, want.Labels) {
+		details = append(details, "labels changed")
+	}
+	if !sameMap(have.Annotations, want.Annotations) {
+		details = append(details, "annotations changed")
+	}
+	return details
+}
+
+func sameMap(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
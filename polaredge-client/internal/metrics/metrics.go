@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	value  func() float64
+	label  string
+	values func() map[string]float64
+}
+
+var (
+	mu      sync.Mutex
+	metrics = make(map[string]metric)
+)
+
+// Gauge registers a gauge whose value is read on every scrape.
+func Gauge(name, help string, value func() float64) {
+	register(metric{name: name, help: help, kind: "gauge", value: value})
+}
+
+// Counter registers a monotonically increasing counter read on every scrape.
+func Counter(name, help string, value func() float64) {
+	register(metric{name: name, help: help, kind: "counter", value: value})
+}
+
+// LabeledGauge registers a gauge with one label; values maps each label value
+// to the gauge value and is read on every scrape.
+func LabeledGauge(name, help, label string, values func() map[string]float64) {
+	register(metric{name: name, help: help, kind: "gauge", label: label, values: values})
+}
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	metrics[m.name] = m
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		names := make([]string, 0, len(metrics))
+		for name := range metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		snapshot := make([]metric, 0, len(names))
+		for _, name := range names {
+			snapshot = append(snapshot, metrics[name])
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range snapshot {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+			if m.values == nil {
+				fmt.Fprintf(w, "%s %g\n", m.name, m.value())
+				continue
+			}
+			values := m.values()
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(w, "%s{%s=%q} %g\n", m.name, m.label, k, values[k])
+			}
+		}
+	})
+}
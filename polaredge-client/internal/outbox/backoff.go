@@ -0,0 +1,33 @@
+package outbox
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff produces exponentially growing delays with jitter, so a fleet of
+// clients does not hammer an agent that just came back.
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	attempt int
+}
+
+// Next returns the delay before the next attempt. The delay doubles with every
+// call up to Max and is jittered to between half and all of that value.
+func (b *Backoff) Next() time.Duration {
+	d := b.Base << b.attempt
+	if d <= 0 || d > b.Max {
+		d = b.Max
+	} else {
+		b.attempt++
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Reset starts the sequence over after a successful attempt.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,329 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Snapshot is one manifest waiting to be delivered.
+type Snapshot struct {
+	Generation int64           `json:"generation"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Manifest   json.RawMessage `json:"manifest"`
+	// PendingSince is when the agents last stopped being in sync, i.e. the
+	// creation time of the oldest snapshot this one replaced.
+	PendingSince time.Time `json:"pendingSince"`
+}
+
+// ErrRejected marks a delivery the agent refused for good. The generation is
+// not retried on that agent; the next snapshot is delivered as usual.
+var ErrRejected = errors.New("rejected")
+
+// DeliverFunc pushes a snapshot to one agent. It returns true once the agent
+// has applied the generation and false while the agent still has it queued.
+// An error wrapping ErrRejected stops retries of the generation.
+type DeliverFunc func(agent string, snap Snapshot) (applied bool, err error)
+
+// state is what the outbox persists between restarts.
+type state struct {
+	Pending *Snapshot        `json:"pending,omitempty"`
+	Applied map[string]int64 `json:"applied"`
+}
+
+// Outbox keeps the latest snapshot on disk until every agent has applied it,
+// retrying each agent independently. A newer snapshot always replaces an older
+// one, so agents receive the newest state as soon as they are reachable again.
+// A generation counts as delivered once a quorum of agents has applied it.
+type Outbox struct {
+	path    string
+	agents  []string
+	quorum  int
+	deliver DeliverFunc
+
+	mu         sync.Mutex
+	pending    *Snapshot
+	applied    map[string]int64 // agent → last applied generation
+	rejected   map[string]int64 // agent → last rejected generation
+	quorumGen  int64            // newest generation that reached quorum
+	failures   int64
+	wake       map[string]chan struct{}
+	onDelivery func(generation int64, applied, total int)
+}
+
+// Open restores the outbox state from dir. quorum is the number of agents that
+// must apply a generation before it counts as delivered; 0 means a majority.
+func Open(dir string, agents []string, quorum int, deliver DeliverFunc) (*Outbox, error) {
+	if len(agents) == 0 {
+		return nil, errors.New("no agents configured")
+	}
+	if quorum <= 0 {
+		quorum = len(agents)/2 + 1
+	}
+	if quorum > len(agents) {
+		return nil, fmt.Errorf("quorum %d exceeds the %d configured agents", quorum, len(agents))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create outbox dir: %w", err)
+	}
+
+	o := &Outbox{
+		path:     filepath.Join(dir, "outbox.json"),
+		agents:   agents,
+		quorum:   quorum,
+		deliver:  deliver,
+		applied:  make(map[string]int64),
+		rejected: make(map[string]int64),
+		wake:     make(map[string]chan struct{}),
+	}
+	for _, agent := range agents {
+		o.wake[agent] = make(chan struct{}, 1)
+	}
+
+	data, err := os.ReadFile(o.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("read outbox: %w", err)
+	default:
+		var st state
+		if err := json.Unmarshal(data, &st); err != nil {
+			log.Printf("⚠️  Discarding unreadable outbox %s: %v", o.path, err)
+			break
+		}
+		for agent, gen := range st.Applied {
+			o.applied[agent] = gen
+		}
+		if st.Pending != nil {
+			log.Printf("📬 Restored undelivered generation %d from %s", st.Pending.Generation, o.path)
+			o.pending = st.Pending
+		}
+	}
+	return o, nil
+}
+
+// Put stores manifest as the newest state and schedules its delivery.
+func (o *Outbox) Put(manifest []byte) error {
+	now := time.Now()
+
+	o.mu.Lock()
+	snap := &Snapshot{
+		Generation:   now.UnixNano(),
+		CreatedAt:    now,
+		Manifest:     manifest,
+		PendingSince: now,
+	}
+	if o.pending != nil {
+		snap.PendingSince = o.pending.PendingSince
+		if snap.Generation <= o.pending.Generation {
+			snap.Generation = o.pending.Generation + 1
+		}
+	}
+	o.pending = snap
+	err := o.saveLocked()
+	o.mu.Unlock()
+
+	o.signalAll()
+	return err
+}
+
+// OnDelivery registers a callback run when a generation reaches quorum and
+// again when the last straggler applies it.
+func (o *Outbox) OnDelivery(fn func(generation int64, applied, total int)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.onDelivery = fn
+}
+
+// Run delivers pending snapshots to every agent until stop is closed.
+func (o *Outbox) Run(stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, agent := range o.agents {
+		wg.Add(1)
+		go func(agent string) {
+			defer wg.Done()
+			o.runAgent(agent, stop)
+		}(agent)
+	}
+	wg.Wait()
+}
+
+func (o *Outbox) runAgent(agent string, stop <-chan struct{}) {
+	backoff := Backoff{Base: 500 * time.Millisecond, Max: time.Minute}
+	for {
+		snap := o.next(agent)
+		if snap == nil {
+			select {
+			case <-o.wake[agent]:
+				continue
+			case <-stop:
+				return
+			}
+		}
+
+		applied, err := o.deliver(agent, *snap)
+		if err == nil && applied {
+			backoff.Reset()
+			o.markApplied(agent, snap.Generation)
+			continue
+		}
+
+		if errors.Is(err, ErrRejected) {
+			backoff.Reset()
+			o.mu.Lock()
+			o.failures++
+			o.rejected[agent] = snap.Generation
+			o.mu.Unlock()
+			log.Printf("❌ %s rejected generation %d, waiting for the next change: %v", agent, snap.Generation, err)
+			continue
+		}
+
+		delay := backoff.Next()
+		if err != nil {
+			o.mu.Lock()
+			o.failures++
+			o.mu.Unlock()
+			log.Printf("⚠️  Delivery of generation %d to %s failed, retrying in %s: %v", snap.Generation, agent, delay.Round(time.Millisecond), err)
+		} else {
+			log.Printf("⏳ Generation %d still queued on %s, checking again in %s", snap.Generation, agent, delay.Round(time.Millisecond))
+		}
+		select {
+		case <-time.After(delay):
+		case <-o.wake[agent]:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// next returns the pending snapshot if agent has neither applied nor
+// rejected it yet.
+func (o *Outbox) next(agent string) *Snapshot {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.pending == nil || o.applied[agent] >= o.pending.Generation || o.rejected[agent] >= o.pending.Generation {
+		return nil
+	}
+	return o.pending
+}
+
+func (o *Outbox) markApplied(agent string, generation int64) {
+	o.mu.Lock()
+
+	if generation > o.applied[agent] {
+		o.applied[agent] = generation
+	}
+	// A newer snapshot may have arrived while this one was in flight.
+	if o.pending == nil || o.pending.Generation != generation {
+		_ = o.saveLocked()
+		o.mu.Unlock()
+		return
+	}
+
+	count := o.appliedCountLocked(generation)
+	notify := false
+	if count >= o.quorum && o.quorumGen < generation {
+		o.quorumGen = generation
+		notify = true
+	}
+	if count == len(o.agents) {
+		o.pending = nil
+		notify = true
+	}
+	if err := o.saveLocked(); err != nil {
+		log.Printf("⚠️  Failed to persist outbox: %v", err)
+	}
+	onDelivery := o.onDelivery
+	o.mu.Unlock()
+
+	if notify && onDelivery != nil {
+		onDelivery(generation, count, len(o.agents))
+	}
+}
+
+func (o *Outbox) appliedCountLocked(generation int64) int {
+	count := 0
+	for _, agent := range o.agents {
+		if o.applied[agent] >= generation {
+			count++
+		}
+	}
+	return count
+}
+
+// Quorum returns the number of agents that must apply a generation.
+func (o *Outbox) Quorum() int {
+	return o.quorum
+}
+
+// Age returns how long the agents have been missing the newest state, or 0
+// when every agent has applied it.
+func (o *Outbox) Age() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.pending == nil {
+		return 0
+	}
+	return time.Since(o.pending.PendingSince)
+}
+
+// Pending reports whether a snapshot is waiting for at least one agent.
+func (o *Outbox) Pending() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending != nil
+}
+
+// QuorumReached reports whether the newest state is applied by a quorum.
+func (o *Outbox) QuorumReached() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending == nil || o.appliedCountLocked(o.pending.Generation) >= o.quorum
+}
+
+// Applied returns the last generation each agent has applied.
+func (o *Outbox) Applied() map[string]int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	applied := make(map[string]int64, len(o.agents))
+	for _, agent := range o.agents {
+		applied[agent] = o.applied[agent]
+	}
+	return applied
+}
+
+// Failures returns the number of failed delivery attempts so far.
+func (o *Outbox) Failures() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.failures
+}
+
+func (o *Outbox) saveLocked() error {
+	data, err := json.Marshal(state{Pending: o.pending, Applied: o.applied})
+	if err != nil {
+		return err
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	return nil
+}
+
+func (o *Outbox) signalAll() {
+	for _, ch := range o.wake {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Base: 100 * time.Millisecond, Max: time.Second}
+	for _, ceiling := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		ceiling *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			// Draw from copies, so every draw sees the same step.
+			probe := b
+			if d := probe.Next(); d < ceiling/2 || d > ceiling {
+				t.Fatalf("delay %s outside [%s, %s]", d, ceiling/2, ceiling)
+			}
+		}
+		b.Next()
+	}
+
+	b.Reset()
+	if d := b.Next(); d > 100*time.Millisecond {
+		t.Fatalf("delay after Reset = %s, want at most the base", d)
+	}
+
+	// Shifting far past Max must not overflow into a negative delay.
+	long := Backoff{Base: time.Second, Max: time.Hour}
+	for i := 0; i < 100; i++ {
+		if d := long.Next(); d <= 0 || d > time.Hour {
+			t.Fatalf("delay %d = %s, want it in (0, %s]", i, d, time.Hour)
+		}
+	}
+	if d := long.Next(); d < 30*time.Minute {
+		t.Fatalf("delay after 100 attempts = %s, want it held near %s", d, time.Hour)
+	}
+}
+
+// fleet is a DeliverFunc whose agents apply, fail or reject on demand.
+type fleet struct {
+	mu       sync.Mutex
+	down     map[string]bool
+	rejects  map[string]bool
+	attempts map[string]int
+}
+
+func newFleet() *fleet {
+	return &fleet{down: map[string]bool{}, rejects: map[string]bool{}, attempts: map[string]int{}}
+}
+
+func (f *fleet) deliver(agent string, snap Snapshot) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[agent]++
+	switch {
+	case f.rejects[agent]:
+		return false, fmt.Errorf("%w: bad manifest", ErrRejected)
+	case f.down[agent]:
+		return false, errors.New("connection refused")
+	}
+	return true, nil
+}
+
+func (f *fleet) set(agent string, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down[agent] = down
+}
+
+type delivery struct {
+	generation     int64
+	applied, total int
+}
+
+func waitDelivery(t *testing.T, ch <-chan delivery) delivery {
+	t.Helper()
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery reported")
+		return delivery{}
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	agents := []string{"a:9100", "b:9100", "c:9100"}
+	f := newFleet()
+	f.set("c:9100", true)
+	o, err := Open(t.TempDir(), agents, 0, f.deliver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Quorum() != 2 {
+		t.Fatalf("default quorum of 3 agents = %d, want a majority of 2", o.Quorum())
+	}
+	deliveries := make(chan delivery, 4)
+	o.OnDelivery(func(generation int64, applied, total int) {
+		deliveries <- delivery{generation, applied, total}
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go o.Run(stop)
+
+	if err := o.Put([]byte(`[]`)); err != nil {
+		t.Fatal(err)
+	}
+	// Two of three agents make the quorum while c keeps failing.
+	d := waitDelivery(t, deliveries)
+	if d.applied != 2 || d.total != 3 {
+		t.Fatalf("first report = %+v, want 2 of 3", d)
+	}
+	if !o.QuorumReached() || !o.Pending() {
+		t.Fatalf("QuorumReached = %t, Pending = %t, want true, true", o.QuorumReached(), o.Pending())
+	}
+
+	// The straggler gets the same generation once it is back.
+	f.set("c:9100", false)
+	o.signalAll()
+	if last := waitDelivery(t, deliveries); last.generation != d.generation || last.applied != 3 {
+		t.Fatalf("second report = %+v, want generation %d applied by 3", last, d.generation)
+	}
+	if o.Pending() {
+		t.Fatal("the snapshot is still pending after every agent applied it")
+	}
+	if o.Failures() == 0 {
+		t.Fatal("the failed attempts on c were not counted")
+	}
+	for agent, gen := range o.Applied() {
+		if gen != d.generation {
+			t.Errorf("%s applied %d, want %d", agent, gen, d.generation)
+		}
+	}
+}
+
+func TestRejectedGenerationIsNotRetried(t *testing.T) {
+	f := newFleet()
+	f.rejects["a:9100"] = true
+	o, err := Open(t.TempDir(), []string{"a:9100"}, 1, f.deliver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go o.Run(stop)
+
+	if err := o.Put([]byte(`[]`)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	o.signalAll()
+	time.Sleep(100 * time.Millisecond)
+	f.mu.Lock()
+	attempts := f.attempts["a:9100"]
+	f.mu.Unlock()
+	if attempts != 1 {
+		t.Fatalf("%d attempts of a rejected generation, want 1", attempts)
+	}
+	if !o.Pending() || o.QuorumReached() {
+		t.Fatal("a rejected generation counted as delivered")
+	}
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	agents := []string{"a:9100", "b:9100"}
+	if _, err := Open(dir, agents, 3, nil); err == nil {
+		t.Fatal("a quorum above the agent count was accepted")
+	}
+
+	o, err := Open(dir, agents, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Put([]byte(`["first"]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Put([]byte(`["second"]`)); err != nil {
+		t.Fatal(err)
+	}
+	o.markApplied("a:9100", o.pending.Generation)
+	want := *o.pending
+
+	restored, err := Open(dir, agents, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := restored.next("b:9100")
+	if got == nil || got.Generation != want.Generation || string(got.Manifest) != `["second"]` {
+		t.Fatalf("restored snapshot = %+v, want generation %d with the newest manifest", got, want.Generation)
+	}
+	if restored.next("a:9100") != nil {
+		t.Fatal("the restored outbox resends a generation a already applied")
+	}
+	if !got.PendingSince.Equal(want.PendingSince) || got.PendingSince.After(got.CreatedAt) {
+		t.Fatalf("PendingSince = %v, want the first snapshot's creation %v", got.PendingSince, want.PendingSince)
+	}
+}
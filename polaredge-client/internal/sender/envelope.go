@@ -0,0 +1,154 @@
+package sender
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// envelopeVersion must match the version understood by the agent.
+const envelopeVersion = 1
+
+// Signature algorithms supported by the agent.
+const (
+	AlgHMACSHA256 = "hmac-sha256"
+	AlgEd25519    = "ed25519"
+)
+
+// Envelope wraps a manifest with the metadata the agent authenticates.
+type Envelope struct {
+	Version    int             `json:"version"`
+	Client     string          `json:"client"`
+	Generation int64           `json:"generation"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Manifest   json.RawMessage `json:"manifest"`
+	Signature  *Signature      `json:"signature,omitempty"`
+}
+
+// Signature identifies the key and carries the signature over signingBytes.
+type Signature struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"keyID"`
+	Value     []byte `json:"value"`
+}
+
+// Ack statuses sent by the agent.
+const (
+	AckApplied  = "applied"
+	AckQueued   = "queued"
+	AckRejected = "rejected"
+)
+
+// Reasons of a rejected ack that resending the same generation cannot fix.
+// Any other reason, or none from an older agent, is worth a retry.
+const (
+	ReasonBadManifest = "bad-manifest"
+	ReasonSuperseded  = "superseded"
+)
+
+// Ack is the agent's reply to a delivered envelope.
+type Ack struct {
+	Status            string `json:"status"`
+	Generation        int64  `json:"generation,omitempty"`
+	AppliedGeneration int64  `json:"appliedGeneration,omitempty"`
+	Error             string `json:"error,omitempty"`
+	// Reason classifies a rejection, e.g. ReasonBadManifest.
+	Reason string `json:"reason,omitempty"`
+	// Pending lists the client's routes ("host:port") held back until the
+	// edge operator approves them.
+	Pending []string `json:"pending,omitempty"`
+	// Rejected lists the client's routes left out as invalid or conflicting,
+	// each as "host/path:port: reason".
+	Rejected []string `json:"rejected,omitempty"`
+	// ConfigHash identifies the config the agent runs with.
+	ConfigHash string `json:"configHash,omitempty"`
+}
+
+// Final reports whether the agent rejected the generation for good.
+func (a *Ack) Final() bool {
+	return a.Status == AckRejected && (a.Reason == ReasonBadManifest || a.Reason == ReasonSuperseded)
+}
+
+// Signer signs envelopes with one configured key.
+type Signer struct {
+	Algorithm string
+	KeyID     string
+	secret    []byte
+	private   ed25519.PrivateKey
+}
+
+// LoadSigner reads a base64 key from keyFile. For hmac-sha256 the file holds
+// the shared secret, for ed25519 the 32-byte seed or 64-byte private key.
+func LoadSigner(alg, keyID, keyFile string) (*Signer, error) {
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("decode signing key: %w", err)
+	}
+
+	s := &Signer{Algorithm: alg, KeyID: keyID}
+	switch alg {
+	case AlgHMACSHA256:
+		s.secret = key
+	case AlgEd25519:
+		switch len(key) {
+		case ed25519.SeedSize:
+			s.private = ed25519.NewKeyFromSeed(key)
+		case ed25519.PrivateKeySize:
+			s.private = ed25519.PrivateKey(key)
+		default:
+			return nil, fmt.Errorf("ed25519 key must be %d or %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return s, nil
+}
+
+// Seal wraps manifest in a signed envelope and returns its wire encoding.
+func (s *Signer) Seal(client string, generation int64, manifest []byte) ([]byte, error) {
+	// Marshal once so the signed bytes are the compact form that ends up on the wire.
+	canonical, err := json.Marshal(json.RawMessage(manifest))
+	if err != nil {
+		return nil, fmt.Errorf("canonicalize manifest: %w", err)
+	}
+
+	env := &Envelope{
+		Version:    envelopeVersion,
+		Client:     client,
+		Generation: generation,
+		Timestamp:  time.Now().UTC(),
+		Manifest:   canonical,
+	}
+
+	msg := env.signingBytes()
+	sig := &Signature{Algorithm: s.Algorithm, KeyID: s.KeyID}
+	switch s.Algorithm {
+	case AlgHMACSHA256:
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(msg)
+		sig.Value = mac.Sum(nil)
+	case AlgEd25519:
+		sig.Value = ed25519.Sign(s.private, msg)
+	}
+	env.Signature = sig
+
+	return json.Marshal(env)
+}
+
+func (e *Envelope) signingBytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "polaredge/v%d\n%s\n%d\n%d\n", e.Version, e.Client, e.Generation, e.Timestamp.UnixNano())
+	buf.Write(e.Manifest)
+	return buf.Bytes()
+}
@@ -0,0 +1,55 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Compression modes understood by the agent, signalled in the frame header.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+var frameMagic = []byte("PEF1")
+
+const (
+	encodingIdentity byte = 0
+	encodingGzip     byte = 1
+)
+
+// frame wraps payload in the agent's frame format:
+//
+//	"PEF1" | encoding (1 byte) | payload length (uint32, big endian) | payload
+func frame(payload []byte, compression string) ([]byte, error) {
+	encoding := encodingIdentity
+	switch compression {
+	case "", CompressionNone:
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(payload); err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		payload = buf.Bytes()
+		encoding = encodingGzip
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+
+	if len(payload) > math.MaxUint32 {
+		return nil, fmt.Errorf("payload of %d bytes does not fit in a frame", len(payload))
+	}
+
+	out := make([]byte, 0, len(frameMagic)+5+len(payload))
+	out = append(out, frameMagic...)
+	out = append(out, encoding)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(payload)))
+	return append(out, payload...), nil
+}
@@ -1,6 +1,9 @@
 package sender
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -21,28 +24,74 @@ func Send(addr string, payload []byte) error {
 	return nil
 }
 
-// SendWithAck sends data to a TCP address and waits for an "ok" response.
-func SendWithAck(addr string, payload []byte) error {
-	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+// ErrRejected is returned when the agent refused the envelope for good, e.g.
+// because the manifest does not parse. Resending it will not help.
+var ErrRejected = errors.New("rejected by agent")
+
+// Transport delivers envelopes to an agent, over mutual TLS when TLS is set
+// and over plain TCP otherwise.
+type Transport struct {
+	TLS *TLSFiles
+	// Compression is applied to every envelope: "gzip" or "none".
+	Compression string
+	// AckTimeout is how long to wait for the agent to apply the manifest.
+	// It should exceed the agent's own ack timeout. Defaults to 30s.
+	AckTimeout time.Duration
+}
+
+// SendWithAck sends an envelope over plain TCP and waits for the agent's ack.
+func SendWithAck(addr string, payload []byte) (*Ack, error) {
+	return (&Transport{}).SendWithAck(addr, payload)
+}
+
+// SendWithAck sends an envelope to addr and waits for the agent's ack.
+// A final rejection is reported as an error wrapping ErrRejected, any other
+// rejection as a plain error worth retrying; an applied or still queued
+// envelope is not an error, and the caller inspects ack.Status.
+func (t *Transport) SendWithAck(addr string, payload []byte) (*Ack, error) {
+	framed, err := frame(payload, t.Compression)
 	if err != nil {
-		return fmt.Errorf("dial %s: %w", addr, err)
+		return nil, err
+	}
+
+	conn, err := t.dial(addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
 	}
 	defer conn.Close()
 
-	_, err = conn.Write(payload)
+	_, err = conn.Write(framed)
 	if err != nil {
-		return fmt.Errorf("write payload: %w", err)
+		return nil, fmt.Errorf("write payload: %w", err)
 	}
 
 	// Wait for ACK
-	buf := make([]byte, 8)
-	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
-	n, err := conn.Read(buf)
-	if err != nil {
-		return fmt.Errorf("read ack: %w", err)
+	timeout := t.AckTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
 	}
-	if string(buf[:n]) != "ok" {
-		return fmt.Errorf("unexpected ack: %q", buf[:n])
+	var ack Ack
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	if err := json.NewDecoder(conn).Decode(&ack); err != nil {
+		return nil, fmt.Errorf("read ack: %w", err)
 	}
-	return nil
+	if ack.Final() {
+		return &ack, fmt.Errorf("%w: generation %d (%s): %s", ErrRejected, ack.Generation, ack.Reason, ack.Error)
+	}
+	if ack.Status == AckRejected {
+		return &ack, fmt.Errorf("agent refused generation %d (%s): %s", ack.Generation, ack.Reason, ack.Error)
+	}
+	return &ack, nil
+}
+
+func (t *Transport) dial(addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 2 * time.Second}
+	if t.TLS == nil {
+		return dialer.Dial("tcp", addr)
+	}
+	cfg, err := t.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	return tls.DialWithDialer(dialer, "tcp", addr, cfg)
 }
@@ -0,0 +1,116 @@
+package sender
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSFiles builds client TLS configs from PEM files and rebuilds them when
+// any of the files changes, so rotated certificates are used on the next dial.
+type TLSFiles struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+
+	mu      sync.Mutex
+	cfg     *tls.Config
+	modTime time.Time
+}
+
+// Config returns the current TLS config, reloading the files if needed.
+func (f *TLSFiles) Config() (*tls.Config, error) {
+	latest, err := latestModTime(f.CAFile, f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cfg != nil && !latest.After(f.modTime) {
+		return f.cfg, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(f.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("CA file contains no certificates")
+	}
+
+	f.cfg = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   f.ServerName,
+	}
+	f.modTime = latest
+	return f.cfg, nil
+}
+
+// DialTLSContext dials addr with the current config, for http.Transport. The
+// files are checked on every dial, like the agent connections, and without
+// an explicit ServerName the certificate must match addr's host.
+func (f *TLSFiles) DialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	cfg, err := f.Config()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: 5 * time.Second}, Config: cfg}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// Identity returns the identity the agent reads from the client certificate:
+// its first URI SAN, else its first DNS SAN.
+func (f *TLSFiles) Identity() (string, error) {
+	cfg, err := f.Config()
+	if err != nil {
+		return "", err
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		return "", fmt.Errorf("parse client certificate: %w", err)
+	}
+	if len(leaf.URIs) > 0 {
+		return leaf.URIs[0].String(), nil
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0], nil
+	}
+	return "", errors.New("client certificate has no URI or DNS SAN")
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
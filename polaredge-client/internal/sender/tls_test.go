@@ -0,0 +1,195 @@
+package sender
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf for tmpl.
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeClientCert writes the client certificate of identity, modified at
+// stamp.
+func writeClientCert(t *testing.T, ca *testCA, f *TLSFiles, identity string, stamp time.Time) {
+	t.Helper()
+	uri, err := url.Parse("spiffe://polaredge/" + identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM := ca.issue(t, &x509.Certificate{
+		URIs:        []*url.URL{uri},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	for path, data := range map[string][]byte{f.CertFile: certPEM, f.KeyFile: keyPEM} {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newAgentAPI serves the URI SAN of the caller's certificate over mTLS, with
+// a certificate for 127.0.0.1 and agent-a.
+func newAgentAPI(t *testing.T, ca *testCA) *httptest.Server {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, &x509.Certificate{
+		DNSNames:    []string{"agent-a"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].URIs[0].String())
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTLSFiles(t *testing.T, ca *testCA) *TLSFiles {
+	t.Helper()
+	dir := t.TempDir()
+	f := &TLSFiles{
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client-key.pem"),
+	}
+	if err := os.WriteFile(f.CAFile, ca.pem, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func get(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestDialTLSContextReloadsClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newAgentAPI(t, ca)
+	f := newTLSFiles(t, ca)
+	start := time.Now().Add(time.Minute)
+	writeClientCert(t, ca, f, "c1", start)
+
+	client := &http.Client{Transport: &http.Transport{DialTLSContext: f.DialTLSContext, DisableKeepAlives: true}}
+	if got, err := get(client, srv.URL); err != nil || got != "spiffe://polaredge/c1" {
+		t.Fatalf("GET = %q, %v, want c1", got, err)
+	}
+
+	// A rotated certificate is presented on the next connection, without a
+	// new http.Client.
+	writeClientCert(t, ca, f, "c2", start.Add(time.Second))
+	if got, err := get(client, srv.URL); err != nil || got != "spiffe://polaredge/c2" {
+		t.Fatalf("GET after rotation = %q, %v, want c2", got, err)
+	}
+}
+
+func TestDialTLSContextServerName(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newAgentAPI(t, ca)
+	tests := []struct {
+		serverName string
+		ok         bool
+	}{
+		// Without -tls-server-name the certificate is checked against the
+		// host of the URL, 127.0.0.1 here.
+		{"", true},
+		{"agent-a", true},
+		{"agent-b", false},
+	}
+	for _, tt := range tests {
+		f := newTLSFiles(t, ca)
+		f.ServerName = tt.serverName
+		writeClientCert(t, ca, f, "c1", time.Now())
+
+		client := &http.Client{Transport: &http.Transport{DialTLSContext: f.DialTLSContext}}
+		_, err := get(client, srv.URL)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("ServerName %q: GET error = %v, want success %t", tt.serverName, err, tt.ok)
+		}
+	}
+}
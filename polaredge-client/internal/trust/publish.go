@@ -0,0 +1,130 @@
+package trust
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// BundleKey is the ConfigMap key holding the CA bundle.
+const BundleKey = "ca.crt"
+
+// Publisher copies the internal CA certificates of the agents into a
+// ConfigMap, so in-cluster workloads can trust the private routes.
+type Publisher struct {
+	// APIs are the agents' HTTP API base URLs.
+	APIs      []string
+	HTTP      *http.Client
+	Namespace string
+	Name      string
+	Interval  time.Duration
+
+	published []byte
+}
+
+// Run publishes the bundle now and then every Interval. It never returns.
+func (p *Publisher) Run() {
+	for {
+		if err := p.sync(); err != nil {
+			log.Printf("⚠️  CA bundle not published: %v", err)
+		}
+		time.Sleep(p.Interval)
+	}
+}
+
+func (p *Publisher) sync() error {
+	bundle, err := p.fetch()
+	if err != nil {
+		return err
+	}
+	if len(bundle) == 0 || bytes.Equal(bundle, p.published) {
+		return nil
+	}
+
+	clientset, err := newClientset()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	cms := clientset.CoreV1().ConfigMaps(p.Namespace)
+	cm, err := cms.Get(ctx, p.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      p.Name,
+				Namespace: p.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "polaredge-client"},
+			},
+			Data: map[string]string{BundleKey: string(bundle)},
+		}
+		_, err = cms.Create(ctx, cm, metav1.CreateOptions{})
+	case err == nil:
+		if cm.Data[BundleKey] == string(bundle) {
+			p.published = bundle
+			return nil
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[BundleKey] = string(bundle)
+		_, err = cms.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("configmap %s/%s: %w", p.Namespace, p.Name, err)
+	}
+	p.published = bundle
+	log.Printf("🔏 Published the agents' CA bundle to configmap %s/%s", p.Namespace, p.Name)
+	return nil
+}
+
+// fetch concatenates the CA certificates of every agent that has one. An
+// agent that cannot be reached fails the whole fetch, so a partial bundle
+// never replaces a complete one.
+func (p *Publisher) fetch() ([]byte, error) {
+	var bundle []byte
+	for _, api := range p.APIs {
+		resp, err := p.HTTP.Get(strings.TrimRight(api, "/") + "/v1/ca")
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if !bytes.Contains(bundle, body) {
+				bundle = append(bundle, body...)
+			}
+		case http.StatusNotFound:
+			// The agent has no internal CA.
+		default:
+			return nil, fmt.Errorf("%s: %s", api, resp.Status)
+		}
+	}
+	return bundle, nil
+}
+
+func newClientset() (*kubernetes.Clientset, error) {
+	kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+	return kubernetes.NewForConfig(config)
+}
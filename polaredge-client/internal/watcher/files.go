@@ -0,0 +1,103 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// Objects holds the resources the resolver works from.
+type Objects struct {
+	Ingresses      []networkingv1.Ingress
+	Services       []corev1.Service
+	EndpointSlices []discoveryv1.EndpointSlice
+}
+
+// LoadDir reads every .yaml, .yml and .json file under dir, including
+// multi-document files and v1 Lists. Other kinds are ignored.
+func LoadDir(dir string) (*Objects, error) {
+	objs := &Objects{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := objs.decode(data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+func (o *Objects) decode(data []byte) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		if err := o.add(doc); err != nil {
+			return err
+		}
+	}
+}
+
+func (o *Objects) add(doc []byte) error {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+	if err != nil {
+		if runtime.IsNotRegisteredError(err) {
+			return nil
+		}
+		return err
+	}
+
+	switch v := obj.(type) {
+	case *networkingv1.Ingress:
+		o.Ingresses = append(o.Ingresses, *v)
+	case *corev1.Service:
+		o.Services = append(o.Services, *v)
+	case *discoveryv1.EndpointSlice:
+		o.EndpointSlices = append(o.EndpointSlices, *v)
+	case *corev1.List:
+		for _, item := range v.Items {
+			if err := o.add(item.Raw); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
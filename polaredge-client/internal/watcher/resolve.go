@@ -0,0 +1,157 @@
+package watcher
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// Resolve turns Ingress rules into manifest routes, resolving each backend
+// Service port and its ready endpoints from the given EndpointSlices. It only
+// looks at the objects passed in, so it works the same against a live cluster
+// and against YAML files on disk.
+func Resolve(ingresses []networkingv1.Ingress, services []corev1.Service, slices []discoveryv1.EndpointSlice) []Ingress {
+	svcIndex := make(map[string]*corev1.Service)
+	for i := range services {
+		svc := &services[i]
+		svcIndex[svc.Namespace+"/"+svc.Name] = svc
+	}
+	sliceIndex := make(map[string][]*discoveryv1.EndpointSlice)
+	for i := range slices {
+		slice := &slices[i]
+		name := slice.Labels[discoveryv1.LabelServiceName]
+		if name == "" {
+			continue
+		}
+		key := slice.Namespace + "/" + name
+		sliceIndex[key] = append(sliceIndex[key], slice)
+	}
+
+	var routes []Ingress
+	for _, ing := range ingresses {
+		annotations := routeAnnotations(ing.Annotations)
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				backend := path.Backend.Service
+				if backend == nil {
+					continue
+				}
+
+				route := Ingress{
+					Namespace:   ing.Namespace,
+					Host:        rule.Host,
+					Path:        path.Path,
+					ServiceName: backend.Name,
+					ServicePort: int(backend.Port.Number),
+					Labels:      ing.Labels,
+					Annotations: annotations,
+				}
+
+				key := ing.Namespace + "/" + backend.Name
+				if svc, ok := svcIndex[key]; ok {
+					if port := findServicePort(svc, backend.Port); port != nil {
+						route.ServicePort = int(port.Port)
+						route.Endpoints = readyEndpoints(sliceIndex[key], port.Name)
+					}
+				}
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Path < b.Path
+	})
+	return routes
+}
+
+// routeAnnotations drops annotations that only matter to kubectl and would
+// bloat every manifest.
+func routeAnnotations(in map[string]string) map[string]string {
+	var out map[string]string
+	for k, v := range in {
+		if k == corev1.LastAppliedConfigAnnotation {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func findServicePort(svc *corev1.Service, ref networkingv1.ServiceBackendPort) *corev1.ServicePort {
+	for i := range svc.Spec.Ports {
+		port := &svc.Spec.Ports[i]
+		if ref.Name != "" && port.Name == ref.Name {
+			return port
+		}
+		if ref.Name == "" && port.Port == ref.Number {
+			return port
+		}
+	}
+	return nil
+}
+
+// readyEndpoints returns "ip:port" for every ready endpoint serving the named
+// service port. EndpointSlice ports carry the resolved target port.
+func readyEndpoints(slices []*discoveryv1.EndpointSlice, portName string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, slice := range slices {
+		if slice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+
+		var target int32
+		for _, p := range slice.Ports {
+			name := ""
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if name == portName && p.Port != nil {
+				target = *p.Port
+				break
+			}
+		}
+		if target == 0 {
+			continue
+		}
+
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				hostPort := net.JoinHostPort(addr, strconv.Itoa(int(target)))
+				if !seen[hostPort] {
+					seen[hostPort] = true
+					out = append(out, hostPort)
+				}
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// String formats a route for logs and diffs.
+func (i Ingress) String() string {
+	return fmt.Sprintf("%s%s → %s/%s:%d", i.Host, i.Path, i.Namespace, i.ServiceName, i.ServicePort)
+}
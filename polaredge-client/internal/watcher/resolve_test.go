@@ -0,0 +1,107 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const shopYAML = `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: shop
+  namespace: shop
+spec:
+  rules:
+    - host: shop.example.com
+      http:
+        paths:
+          - path: /
+            pathType: Prefix
+            backend:
+              service:
+                name: web
+                port:
+                  name: http
+          - path: /static
+            pathType: Prefix
+            backend:
+              service:
+                name: static
+                port:
+                  number: 80
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: shop
+spec:
+  ports:
+    - name: http
+      port: 8080
+      targetPort: 3000
+`
+
+const sliceYAML = `apiVersion: v1
+kind: List
+items:
+  - apiVersion: discovery.k8s.io/v1
+    kind: EndpointSlice
+    metadata:
+      name: web-abc
+      namespace: shop
+      labels:
+        kubernetes.io/service-name: web
+    addressType: IPv4
+    ports:
+      - name: http
+        port: 3000
+    endpoints:
+      - addresses: ["10.42.0.12"]
+        conditions: {ready: true}
+      - addresses: ["10.42.0.11"]
+      - addresses: ["10.42.0.13"]
+        conditions: {ready: false}
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: unrelated
+      namespace: shop
+`
+
+func TestLoadDirResolvesEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"shop.yaml": shopYAML, "slices/web.yml": sliceYAML} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objs, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs.Ingresses) != 1 || len(objs.Services) != 1 || len(objs.EndpointSlices) != 1 {
+		t.Fatalf("loaded %d ingresses, %d services, %d endpoint slices, want 1 each",
+			len(objs.Ingresses), len(objs.Services), len(objs.EndpointSlices))
+	}
+
+	got := Resolve(objs.Ingresses, objs.Services, objs.EndpointSlices)
+	want := []Ingress{
+		// The named port resolves to the Service port, and its ready
+		// endpoints to the slice's target port.
+		{Namespace: "shop", Host: "shop.example.com", Path: "/", ServiceName: "web", ServicePort: 8080,
+			Endpoints: []string{"10.42.0.11:3000", "10.42.0.12:3000"}},
+		// Without a Service the backend is sent as the Ingress names it.
+		{Namespace: "shop", Host: "shop.example.com", Path: "/static", ServiceName: "static", ServicePort: 80},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve =\n%+v\nwant\n%+v", got, want)
+	}
+}
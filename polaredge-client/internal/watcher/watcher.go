@@ -3,10 +3,12 @@ package watcher
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
@@ -15,48 +17,49 @@ import (
 )
 
 type Ingress struct {
+	Namespace   string `json:"namespace,omitempty"`
 	Host        string `json:"host"`
+	Path        string `json:"path,omitempty"`
 	ServiceName string `json:"serviceName"`
 	ServicePort int    `json:"servicePort"`
+	// Endpoints are the ready pod addresses ("ip:port") behind the service.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Labels and Annotations are copied from the Ingress object, so the
+	// agent's exposure policy can match on them.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
-// GetIngresses scans the cluster and returns ingress metadata
-func GetIngresses() []Ingress {
-	var ingresses []Ingress
-
+// GetIngresses scans the cluster and returns ingress metadata. An error means
+// the cluster could not be read; the result must not be sent as the new state.
+func GetIngresses() ([]Ingress, error) {
 	kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
-		log.Printf("Error loading kubeconfig: %v\n", err)
-		return ingresses
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		log.Printf("Error creating clientset: %v\n", err)
-		return ingresses
+		return nil, fmt.Errorf("create clientset: %w", err)
 	}
 
 	allIngresses, err := clientset.NetworkingV1().Ingresses("").List(context.Background(), metav1.ListOptions{})
 	if err != nil {
-		log.Printf("Error listing ingresses: %v\n", err)
-		return ingresses
+		return nil, fmt.Errorf("list ingresses: %w", err)
 	}
 
-	for _, ing := range allIngresses.Items {
-		for _, rule := range ing.Spec.Rules {
-			for _, path := range rule.HTTP.Paths {
-				backend := path.Backend.Service
-				ingresses = append(ingresses, Ingress{
-					Host:        rule.Host,
-					ServiceName: backend.Name,
-					ServicePort: int(backend.Port.Number),
-				})
-			}
-		}
+	services, err := clientset.CoreV1().Services("").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+
+	slices, err := clientset.DiscoveryV1().EndpointSlices("").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list endpoint slices: %w", err)
 	}
 
-	return ingresses
+	return Resolve(allIngresses.Items, services.Items, slices.Items), nil
 }
 
 // EncodeIngresses returns ingress data as JSON bytes
@@ -88,15 +91,28 @@ func StartWatcher(onChange func([]Ingress)) {
 	ingressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			log.Println("🆕 Ingress added")
-			onChange(GetIngresses())
+			notify(onChange)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			log.Println("🔄 Ingress updated")
-			onChange(GetIngresses())
+			notify(onChange)
 		},
 		DeleteFunc: func(obj interface{}) {
 			log.Println("❌ Ingress deleted")
-			onChange(GetIngresses())
+			notify(onChange)
+		},
+	})
+
+	// Pod churn changes the endpoints carried in the manifest.
+	sliceInformer := factory.Discovery().V1().EndpointSlices().Informer()
+	sliceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSlice, newSlice := oldObj.(*discoveryv1.EndpointSlice), newObj.(*discoveryv1.EndpointSlice)
+			if oldSlice.ResourceVersion == newSlice.ResourceVersion {
+				return
+			}
+			log.Printf("🔄 Endpoints of %s/%s changed", newSlice.Namespace, newSlice.Labels[discoveryv1.LabelServiceName])
+			notify(onChange)
 		},
 	})
 
@@ -105,3 +121,14 @@ func StartWatcher(onChange func([]Ingress)) {
 	factory.WaitForCacheSync(stop)
 	<-stop // block forever
 }
+
+// notify passes the current ingresses to onChange, skipping the change when
+// the cluster cannot be read.
+func notify(onChange func([]Ingress)) {
+	ings, err := GetIngresses()
+	if err != nil {
+		log.Printf("⚠️  Cannot read ingresses, keeping the last state: %v", err)
+		return
+	}
+	onChange(ings)
+}
@@ -2,39 +2,260 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"polaredge-client/internal/metrics"
+	"polaredge-client/internal/outbox"
 	"polaredge-client/internal/sender"
+	"polaredge-client/internal/trust"
 	"polaredge-client/internal/watcher"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func sendWithRetries(manifest []byte, retries int) bool {
-	for i := 0; i < retries; i++ {
-		if err := sender.SendWithAck("localhost:9005", manifest); err != nil {
-			log.Printf("⚠️  Send attempt %d failed: %v", i+1, err)
-			time.Sleep(1 * time.Second)
-			continue
+var (
+	agentAddrs = flag.String("agents", "localhost:9005", "comma-separated agent socket addresses")
+	quorum     = flag.Int("quorum", 0, "agents that must apply a manifest before it counts as delivered (0 = majority)")
+	clientID   = flag.String("client-id", defaultClientID(), "identity reported in every envelope (defaults to the -tls-cert SAN under mTLS)")
+	signAlg    = flag.String("sign-alg", sender.AlgHMACSHA256, "signature algorithm: hmac-sha256 or ed25519")
+	keyID      = flag.String("key-id", "", "id of the signing key as configured on the agent")
+	keyFile    = flag.String("key-file", "", "file holding the base64 signing key")
+
+	tlsCA         = flag.String("tls-ca", "", "CA bundle that signed the agent certificate (enables mTLS)")
+	tlsCert       = flag.String("tls-cert", "", "client certificate; its SAN is the identity the agent authorizes")
+	tlsKey        = flag.String("tls-key", "", "client certificate key")
+	tlsServerName = flag.String("tls-server-name", "", "expected agent certificate name (defaults to the agent host)")
+
+	compression = flag.String("compress", sender.CompressionGzip, "manifest compression: gzip or none")
+
+	outboxDir   = flag.String("outbox-dir", "/var/lib/polaredge-client", "directory holding the undelivered manifest")
+	metricsAddr = flag.String("metrics-addr", ":9106", "address serving Prometheus metrics (empty disables)")
+
+	caConfigMap = flag.String("ca-configmap", "", "publish the agents' internal CA bundle to this ConfigMap (empty disables)")
+	caNamespace = flag.String("ca-namespace", "default", "namespace of -ca-configmap")
+	agentAPIs   = flag.String("agent-apis", "", "comma-separated agent HTTP API base URLs, used by -ca-configmap (default: the -agents hosts on -agent-api-port)")
+
+	agentAPIPort = flag.Int("agent-api-port", 9000, "agent HTTP API port, used when -agent-apis is empty")
+	caAllowHTTP  = flag.Bool("ca-allow-http", false, "publish a CA bundle fetched over plain HTTP, which anyone on the path could replace")
+
+	signer    *sender.Signer
+	transport = &sender.Transport{}
+	box       *outbox.Outbox
+)
+
+func defaultClientID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "polaredge-client"
+	}
+	return host
+}
+
+// flagSet reports whether name was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
 		}
-		log.Println("✅ TCP send confirmed.")
-		return true
+	})
+	return set
+}
+
+// deliver seals a snapshot at send time, so the envelope timestamp stays
+// fresh however long the snapshot waited in the outbox.
+func deliver(agent string, snap outbox.Snapshot) (bool, error) {
+	envelope, err := signer.Seal(*clientID, snap.Generation, snap.Manifest)
+	if err != nil {
+		return false, fmt.Errorf("seal manifest: %w", err)
+	}
+	ack, err := transport.SendWithAck(agent, envelope)
+	if errors.Is(err, sender.ErrRejected) {
+		return false, fmt.Errorf("%w: %v", outbox.ErrRejected, err)
+	}
+	if err != nil {
+		return false, err
 	}
-	log.Println("❌ All send attempts failed. Will wait.")
-	return false
+	if len(ack.Pending) > 0 {
+		log.Printf("⏸️  %s holds %d route(s) until the edge operator approves them: %s", agent, len(ack.Pending), strings.Join(ack.Pending, ", "))
+	}
+	for _, reason := range ack.Rejected {
+		log.Printf("⛔ %s rejected a route: %s", agent, reason)
+	}
+	if ack.Status == sender.AckApplied && ack.ConfigHash != "" {
+		log.Printf("🔖 %s applied generation %d, config %s", agent, snap.Generation, ack.ConfigHash)
+	}
+	return ack.Status == sender.AckApplied, nil
+}
+
+func reportDelivery(generation int64, applied, total int) {
+	if applied == total {
+		log.Printf("✅ Generation %d applied by all %d agents.", generation, total)
+		return
+	}
+	log.Printf("✅ Generation %d applied by %d/%d agents (quorum %d), retrying the rest.", generation, applied, total, box.Quorum())
 }
 
 func refreshAndSend() {
 	log.Println("🔁 Refresh triggered.")
-	ings := watcher.GetIngresses()
+	ings, err := watcher.GetIngresses()
+	if err != nil {
+		log.Printf("⚠️  Cannot read ingresses, nothing sent: %v", err)
+		return
+	}
 	data := watcher.EncodeIngresses(ings)
-	if ok := sendWithRetries(data, 3); !ok {
-		fmt.Println(string(data)) // fallback output
+	if err := box.Put(data); err != nil {
+		log.Printf("⚠️  Outbox not persisted, delivery will still be attempted: %v", err)
+	}
+}
+
+// agentAPIURLs returns -agent-apis, or else the HTTP API of every -agents
+// host: https under mTLS, plain http otherwise.
+func agentAPIURLs() ([]string, error) {
+	if *agentAPIs != "" {
+		return splitList(*agentAPIs), nil
+	}
+	scheme := "http"
+	if transport.TLS != nil {
+		scheme = "https"
+	}
+	var urls []string
+	for _, agent := range splitList(*agentAddrs) {
+		host, _, err := net.SplitHostPort(agent)
+		if err != nil {
+			return nil, fmt.Errorf("agent address %q: %w", agent, err)
+		}
+		urls = append(urls, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(*agentAPIPort)))
+	}
+	return urls, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func serveMetrics() {
+	metrics.Gauge("polaredge_outbox_age_seconds", "Seconds since the agent last had the newest manifest (0 when in sync).",
+		func() float64 { return box.Age().Seconds() })
+	metrics.Gauge("polaredge_outbox_pending", "1 while a manifest is waiting for delivery.",
+		func() float64 {
+			if box.Pending() {
+				return 1
+			}
+			return 0
+		})
+	metrics.Gauge("polaredge_outbox_quorum_reached", "1 when a quorum of agents has applied the newest manifest.",
+		func() float64 {
+			if box.QuorumReached() {
+				return 1
+			}
+			return 0
+		})
+	metrics.LabeledGauge("polaredge_agent_applied_generation", "Last manifest generation applied by each agent.", "agent",
+		func() map[string]float64 {
+			values := make(map[string]float64)
+			for agent, gen := range box.Applied() {
+				values[agent] = float64(gen)
+			}
+			return values
+		})
+	metrics.Counter("polaredge_outbox_delivery_failures_total", "Failed manifest delivery attempts.",
+		func() float64 { return float64(box.Failures()) })
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	log.Printf("📊 Metrics on http://%s/metrics", *metricsAddr)
+	if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+		log.Printf("❌ Metrics server failed: %v", err)
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			os.Exit(runRender(os.Args[2:]))
+		case "diff":
+			os.Exit(runDiff(os.Args[2:]))
+		}
+	}
+
+	flag.Parse()
+
 	log.Println("📡 POLAREDGE Client (Hybrid Mode)")
+
+	if *keyID == "" || *keyFile == "" {
+		log.Fatal("❌ -key-id and -key-file are required: the agent rejects unsigned manifests")
+	}
+	var err error
+	signer, err = sender.LoadSigner(*signAlg, *keyID, *keyFile)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	if *tlsCA != "" || *tlsCert != "" || *tlsKey != "" {
+		transport.TLS = &sender.TLSFiles{CAFile: *tlsCA, CertFile: *tlsCert, KeyFile: *tlsKey, ServerName: *tlsServerName}
+		if _, err := transport.TLS.Config(); err != nil {
+			log.Fatalf("❌ TLS setup failed: %v", err)
+		}
+		log.Println("🔐 Using mutual TLS to reach the agent")
+		if !flagSet(flag.CommandLine, "client-id") {
+			if *clientID, err = transport.TLS.Identity(); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+			log.Printf("🪪 Client ID %s taken from the certificate", *clientID)
+		}
+	}
+
+	transport.Compression = *compression
+
+	box, err = outbox.Open(*outboxDir, splitList(*agentAddrs), *quorum, deliver)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	box.OnDelivery(reportDelivery)
+	go box.Run(nil)
+	if *metricsAddr != "" {
+		go serveMetrics()
+	}
+	if *caConfigMap != "" {
+		httpClient := &http.Client{Timeout: 10 * time.Second}
+		if transport.TLS != nil {
+			// Every dial reloads the client certificate and checks the
+			// agent's certificate against that agent's host.
+			httpClient.Transport = &http.Transport{DialTLSContext: transport.TLS.DialTLSContext}
+		}
+		apis, err := agentAPIURLs()
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		for _, api := range apis {
+			if !strings.HasPrefix(api, "https://") && !*caAllowHTTP {
+				log.Fatalf("❌ %s is plain HTTP, so the CA bundle could be replaced on the way: use mTLS (-tls-*) or -ca-allow-http", api)
+			}
+		}
+		publisher := &trust.Publisher{
+			APIs:      apis,
+			HTTP:      httpClient,
+			Namespace: *caNamespace,
+			Name:      *caConfigMap,
+			Interval:  10 * time.Minute,
+		}
+		go publisher.Run()
+	}
+
 	log.Println("Press 'r' to manually trigger a refresh")
 
 	// 1. Start keyboard listener in background
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"polaredge-client/internal/watcher"
+)
+
+// runRender implements `polaredge-client render -f dir/`: it resolves Ingress,
+// Service and EndpointSlice YAML files into the manifest the client would
+// send, without talking to a cluster.
+func runRender(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	dir := fs.String("f", "", "directory of Ingress, Service and EndpointSlice YAML files")
+	toml := fs.Bool("toml", false, "print the Traefik config the agent would render instead of the manifest")
+	agentBin := fs.String("agent-bin", "polaredge-agent", "agent binary used by -toml")
+	fs.Parse(args)
+
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "usage: polaredge-client render -f dir/ [-toml]")
+		return 2
+	}
+
+	objs, err := watcher.LoadDir(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	manifest := watcher.EncodeIngresses(watcher.Resolve(objs.Ingresses, objs.Services, objs.EndpointSlices))
+	if manifest == nil {
+		return 1
+	}
+
+	if !*toml {
+		fmt.Println(string(manifest))
+		return 0
+	}
+
+	cmd := exec.Command(*agentBin, "render")
+	cmd.Stdin = bytes.NewReader(manifest)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s render: %v\n", *agentBin, err)
+		return 1
+	}
+	return 0
+}